@@ -2,12 +2,14 @@ module github.com/igorMSoares/rinha-de-backend-2025
 
 go 1.23.1
 
-require github.com/valyala/fasthttp v1.65.0
+require (
+	github.com/redis/go-redis/v9 v9.12.1
+	github.com/valyala/fasthttp v1.65.0
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/redis/go-redis/v9 v9.12.1 // indirect
 )
 
 require (
@@ -13,22 +13,25 @@ import (
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/breaker"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
-	"gonum.org/v1/gonum/stat/distuv"
 )
 
 var (
 	ErrAllReplicasFailed = errors.New("All replicas failed")
+	ErrNoReplicaReady    = errors.New("circuit breakers of all replicas are open")
+	// ao menos uma réplica executou a requisição antes da falha (5xx, timeout, erro de conexão)
+	ErrReplicaFailed = errors.New("replica failed to process the request")
 )
 
 type LoadBalancer struct {
-	DefaultReplica   *Replica
-	FallbackReplica  *Replica
-	CostWeight       float64
-	latencyThreshold int64
-	timeout          time.Duration
-	httpClient       *http.FastHTTPClient
-	circuitOpen      atomic.Bool
-	circuitTimeout   time.Duration
+	DefaultReplica  *Replica
+	FallbackReplica *Replica
+	config          atomic.Pointer[Config]
+	strategy        SelectionStrategy
+	httpClient      *http.FastHTTPClient
+	circuitOpen     atomic.Bool
+	counters        requestCounters
+	bulkheadWait    time.Duration
+	sharedStats     bool
 }
 
 func NewLoadBalancer(
@@ -41,12 +44,10 @@ func NewLoadBalancer(
 	failureThreshold, _ := strconv.Atoi(utils.Getenv("CB_FAILURE_THRESHOLD", "5"))
 	timeout, _ := time.ParseDuration(utils.Getenv("PROCESSOR_REQ_TIMEOUT", "500ms"))
 	circuitTimeout, _ := time.ParseDuration(utils.Getenv("LB_CIRCUIT_TIMEOUT", "500ms"))
-
-	breakerCfg := &breaker.CircuitBreakerCfg{
-		RecoveryTimeout:  recoveryTimeout,
-		RecoveryAttempts: recoveryAttempts,
-		FailureThreshold: failureThreshold,
-	}
+	defaultLimit, _ := strconv.Atoi(utils.Getenv("BULKHEAD_DEFAULT_LIMIT", "0"))
+	fallbackLimit, _ := strconv.Atoi(utils.Getenv("BULKHEAD_FALLBACK_LIMIT", "0"))
+	bulkheadWait := utils.GetenvDuration("BULKHEAD_WAIT", "500ms")
+	sharedStats := utils.Getenv("LB_SHARED_STATS", "false") == "true"
 
 	if costWeight < 0.0 {
 		costWeight = 0 // Cost is not relevant for the score
@@ -55,32 +56,42 @@ func NewLoadBalancer(
 		costWeight = 0.99 // Cost is critical for the score
 	}
 
-	return &LoadBalancer{
-		DefaultReplica: &Replica{
-			Type: http.DefaultHost,
-			Stats: &ReplicaStats{
-				LatencyAlpha: 1.5, // priorizado
-				LatencyBeta:  1.0,
-			},
-			CircuitBreaker: breaker.NewCircuitBreaker(breakerCfg),
-		},
-		FallbackReplica: &Replica{
-			Type: http.FallbackHost,
-			Stats: &ReplicaStats{
-				LatencyAlpha: 1.0,
-				LatencyBeta:  1.0,
-			},
-			CircuitBreaker: breaker.NewCircuitBreaker(breakerCfg),
-		},
-		CostWeight:       1.0 - costWeight,
-		latencyThreshold: latencyThreshold,
-		timeout:          timeout,
-		circuitTimeout:   circuitTimeout,
+	lb := &LoadBalancer{
+		bulkheadWait: bulkheadWait,
+		sharedStats:  sharedStats,
 		httpClient: http.NewFastHTTPClient(
 			defaultCfg,
 			fallbackCfg,
 		),
 	}
+
+	lb.config.Store(&Config{
+		CostWeight:     costWeight,
+		LatencyLimit:   time.Duration(latencyThreshold),
+		RequestTimeout: timeout,
+		CircuitTimeout: circuitTimeout,
+		Breaker: breaker.CircuitBreakerCfg{
+			RecoveryTimeout:  recoveryTimeout,
+			RecoveryAttempts: recoveryAttempts,
+			FailureThreshold: failureThreshold,
+		},
+	})
+
+	lb.DefaultReplica = &Replica{
+		Type:           http.DefaultHost,
+		Stats:          newReplicaStats(1.5, 1.0, sharedStats), // priorizado
+		CircuitBreaker: breaker.NewCircuitBreaker(http.DefaultHost, lb.breakerConfig),
+		Bulkhead:       NewBulkhead(defaultLimit),
+	}
+	lb.FallbackReplica = &Replica{
+		Type:           http.FallbackHost,
+		Stats:          newReplicaStats(1.0, 1.0, sharedStats),
+		CircuitBreaker: breaker.NewCircuitBreaker(http.FallbackHost, lb.breakerConfig),
+		Bulkhead:       NewBulkhead(fallbackLimit),
+	}
+	lb.strategy = newSelectionStrategy(lb)
+
+	return lb
 }
 
 func (lb *LoadBalancer) selectReplica() *Replica {
@@ -95,58 +106,49 @@ func (lb *LoadBalancer) selectReplica() *Replica {
 		return lb.DefaultReplica
 	}
 
-	lb.DefaultReplica.Stats.RLock()
-	betaDefault := distuv.Beta{
-		Alpha: lb.DefaultReplica.Stats.LatencyAlpha,
-		Beta:  lb.DefaultReplica.Stats.LatencyBeta,
-	}
-	lb.DefaultReplica.Stats.RUnlock()
-
-	lb.FallbackReplica.Stats.RLock()
-	betaFallback := distuv.Beta{
-		Alpha: lb.FallbackReplica.Stats.LatencyAlpha,
-		Beta:  lb.FallbackReplica.Stats.LatencyBeta,
-	}
-	lb.FallbackReplica.Stats.RUnlock()
-
-	scoreDefault := betaDefault.Rand()
-	scoreFallback := betaFallback.Rand() * lb.CostWeight
-
-	if scoreDefault > scoreFallback {
-		// log.Println("Selected default replica")
-		return lb.DefaultReplica
+	// desvia de uma réplica que o service-health reporta como instável
+	defaultHealthy, fallbackHealthy := lb.healthy(lb.DefaultReplica), lb.healthy(lb.FallbackReplica)
+	if defaultHealthy != fallbackHealthy {
+		if defaultHealthy {
+			return lb.DefaultReplica
+		}
+		return lb.FallbackReplica
 	}
 
-	// log.Println("Selected fallback replica")
-	return lb.FallbackReplica
+	return lb.strategy.Select(lb.DefaultReplica, lb.FallbackReplica)
 }
 
 func (lb *LoadBalancer) UpdateLatency(stats *ReplicaStats, responseTime int64) {
-	if responseTime < 0 || responseTime > lb.latencyThreshold {
+	latencyThreshold := lb.config.Load().LatencyLimit.Nanoseconds()
+	if responseTime < 0 || responseTime > latencyThreshold {
 		inc := 1.0
-		if responseTime > lb.latencyThreshold {
+		if responseTime > latencyThreshold {
 			// incremento proporcional à latencia (min: 0.5, max: ~1.5)
-			inc = float64((responseTime-lb.latencyThreshold)/responseTime) + 0.5
+			inc = float64((responseTime-latencyThreshold)/responseTime) + 0.5
 		}
 
-		stats.Lock()
-		stats.LatencyBeta += inc
-		stats.Unlock()
+		stats.add(0, inc)
 		return
 	}
 
 	// score normalizado, quanto mais perto de 1.0 melhor (min: 0.0, max: ~0.99)
-	latencyScore := math.Max(0, float64(lb.latencyThreshold-responseTime)) / float64(lb.latencyThreshold)
+	latencyScore := math.Max(0, float64(latencyThreshold-responseTime)) / float64(latencyThreshold)
 
 	// incremento proporcional ao latencyScore
 	weightedAlphaIncrement := 0.1 + 0.9*latencyScore // maior o latencyScore, maior o incremento (min: 0.1, max: ~0.99)
 	// também incrementa beta para equilibrar a distribuição
 	weightedBetaIncrement := 0.1 + 0.4*(1-latencyScore) // maior o latencyScore, menor o incremento (min: 0.1, max: ~0.5)
 
-	stats.Lock()
-	stats.LatencyAlpha += weightedAlphaIncrement
-	stats.LatencyBeta += weightedBetaIncrement
-	stats.Unlock()
+	stats.add(weightedAlphaIncrement, weightedBetaIncrement)
+}
+
+// Pronto quando ao menos uma réplica não está com o circuito aberto
+func (lb *LoadBalancer) Ready(ctx context.Context) error {
+	if lb.DefaultReplica.CircuitBreaker.State() == breaker.Open && lb.FallbackReplica.CircuitBreaker.State() == breaker.Open {
+		return ErrNoReplicaReady
+	}
+
+	return nil
 }
 
 func (lb *LoadBalancer) AllowWork() bool {
@@ -160,8 +162,9 @@ func (lb *LoadBalancer) openCircuit() {
 
 	lb.circuitOpen.Store(true)
 
-	timer := time.NewTimer(lb.circuitTimeout)
-	log.Printf("All external services down: load balancer stopping for %v", lb.circuitTimeout)
+	circuitTimeout := lb.CircuitTimeout()
+	timer := time.NewTimer(circuitTimeout)
+	log.Printf("All external services down: load balancer stopping for %v", circuitTimeout)
 	go func() {
 		<-timer.C
 		log.Println("Load balancer is allowing requests")
@@ -177,11 +180,18 @@ func (lb *LoadBalancer) MakeRequest(body []byte, replica *Replica) (http.HostTyp
 			log.Println("lb.MakeRequest::ErrAllReplicasFailed")
 			return http.NilHost, ErrAllReplicasFailed
 		}
+		r = lb.acquireReplica(r)
+		if r == nil {
+			return http.NilHost, ErrBulkheadFull
+		}
 	} else {
 		r = replica
+		if !r.Bulkhead.Acquire(lb.bulkheadWait) {
+			return http.NilHost, ErrBulkheadFull
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), lb.timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), lb.config.Load().RequestTimeout)
 	defer cancel()
 
 	responseTime, err := r.CircuitBreaker.Execute(
@@ -190,6 +200,9 @@ func (lb *LoadBalancer) MakeRequest(body []byte, replica *Replica) (http.HostTyp
 		body,
 		lb.httpClient.POST,
 	)
+	// libera a vaga antes de um possível retry na outra réplica
+	r.Bulkhead.Release()
+	lb.counters.record(responseTime, err)
 	if err != nil {
 		if errors.Is(err, http.ErrAlreadyProcessed) {
 			return r.Type, err
@@ -200,11 +213,12 @@ func (lb *LoadBalancer) MakeRequest(body []byte, replica *Replica) (http.HostTyp
 		}
 
 		if !errors.Is(err, breaker.ErrCircuitOpen) {
-			go lb.UpdateLatency(r.Stats, -1)
+			go lb.strategy.Observe(r, -1)
+			err = fmt.Errorf("%w: %w", ErrReplicaFailed, err)
 		}
 
 		// Retry com outra réplica
-		host, err := lb.tryOtherReplica(r, body)
+		host, err := lb.tryOtherReplica(r, err, body)
 		if err != nil && errors.Is(err, ErrAllReplicasFailed) {
 			lb.openCircuit()
 		}
@@ -212,11 +226,31 @@ func (lb *LoadBalancer) MakeRequest(body []byte, replica *Replica) (http.HostTyp
 		return host, err
 	}
 
-	go lb.UpdateLatency(r.Stats, responseTime)
+	go lb.strategy.Observe(r, responseTime)
 
 	return r.Type, nil
 }
 
+// Reserva uma vaga na réplica selecionada. Se ela estiver no limite de requisições
+// simultâneas desvia para a outra réplica e, se as duas estiverem cheias, aguarda
+// uma vaga na selecionada
+func (lb *LoadBalancer) acquireReplica(selected *Replica) *Replica {
+	if selected.Bulkhead.TryAcquire() {
+		return selected
+	}
+
+	other := lb.swapReplica(selected)
+	if other != nil && !other.CircuitBreaker.CircuitOpen.Load() && other.Bulkhead.TryAcquire() {
+		return other
+	}
+
+	if selected.Bulkhead.Acquire(lb.bulkheadWait) {
+		return selected
+	}
+
+	return nil
+}
+
 func (lb *LoadBalancer) swapReplica(r *Replica) *Replica {
 	switch r.Type {
 	case http.DefaultHost:
@@ -228,15 +262,23 @@ func (lb *LoadBalancer) swapReplica(r *Replica) *Replica {
 	}
 }
 
-func (lb *LoadBalancer) tryOtherReplica(failed *Replica, body []byte) (http.HostType, error) {
+// O erro da réplica que falhou é mantido na cadeia: se ela chegou a executar a
+// requisição (ErrReplicaFailed) o retry.Classify conta uma tentativa, mesmo que a
+// outra réplica esteja indisponível
+func (lb *LoadBalancer) tryOtherReplica(failed *Replica, cause error, body []byte) (http.HostType, error) {
 	otherReplica := lb.swapReplica(failed)
 	if otherReplica == nil {
 		return http.NilHost, fmt.Errorf("lb.swapReplica returned nil Replica")
 	}
 
 	if !otherReplica.CircuitBreaker.AllowRequest() {
-		return http.NilHost, ErrAllReplicasFailed
+		return http.NilHost, fmt.Errorf("%w: %w", ErrAllReplicasFailed, cause)
+	}
+
+	host, err := lb.MakeRequest(body, otherReplica)
+	if err != nil && !errors.Is(err, http.ErrAlreadyProcessed) && !errors.Is(err, ErrReplicaFailed) {
+		err = fmt.Errorf("%w (%v replica: %w)", err, failed.Type, cause)
 	}
 
-	return lb.MakeRequest(body, otherReplica)
+	return host, err
 }
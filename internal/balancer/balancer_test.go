@@ -0,0 +1,49 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+)
+
+func newTestLoadBalancer(t *testing.T) *LoadBalancer {
+	t.Helper()
+	t.Setenv("LB_STRATEGY", StrategyDefaultFirst)
+
+	hostCfg := &http.HostCfg{Addr: "127.0.0.1:0", Endpoint: "http://127.0.0.1:0/payments"}
+	return NewLoadBalancer(hostCfg, hostCfg, 0.25, 100_000_000)
+}
+
+func TestSelectReplicaAvoidsTrippedReplica(t *testing.T) {
+	lb := newTestLoadBalancer(t)
+
+	if r := lb.selectReplica(); r != lb.DefaultReplica {
+		t.Fatalf("expected default replica before trip, got %v", r.Type)
+	}
+
+	lb.DefaultReplica.CircuitBreaker.Trip()
+	// o circuito continua aberto até o CB_RECOVERY_TIMEOUT
+	time.Sleep(20 * time.Millisecond)
+
+	if r := lb.selectReplica(); r != lb.FallbackReplica {
+		t.Fatalf("expected fallback replica after tripping default, got %v", r)
+	}
+}
+
+func TestReadyFailsWhenAllBreakersAreOpen(t *testing.T) {
+	lb := newTestLoadBalancer(t)
+	ctx := context.Background()
+
+	lb.DefaultReplica.CircuitBreaker.Trip()
+	if err := lb.Ready(ctx); err != nil {
+		t.Fatalf("expected ready with fallback closed, got %v", err)
+	}
+
+	lb.FallbackReplica.CircuitBreaker.Trip()
+	if err := lb.Ready(ctx); !errors.Is(err, ErrNoReplicaReady) {
+		t.Fatalf("expected ErrNoReplicaReady, got %v", err)
+	}
+}
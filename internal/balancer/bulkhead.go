@@ -0,0 +1,72 @@
+package balancer
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrBulkheadFull = errors.New("Replica concurrency limit reached")
+)
+
+// Limita a qtd de requisições simultâneas para uma réplica, evitando que um processor
+// lento ocupe todos os workers. Limite 0 desativa o bulkhead
+type Bulkhead struct {
+	slots chan struct{}
+}
+
+func NewBulkhead(limit int) *Bulkhead {
+	if limit <= 0 {
+		return &Bulkhead{}
+	}
+
+	return &Bulkhead{
+		slots: make(chan struct{}, limit),
+	}
+}
+
+func (b *Bulkhead) TryAcquire() bool {
+	if b.slots == nil {
+		return true
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Aguarda uma vaga por até wait
+func (b *Bulkhead) Acquire(wait time.Duration) bool {
+	if b.TryAcquire() {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (b *Bulkhead) Release() {
+	if b.slots == nil {
+		return
+	}
+
+	<-b.slots
+}
+
+func (b *Bulkhead) InFlight() int {
+	return len(b.slots)
+}
+
+func (b *Bulkhead) Limit() int {
+	return cap(b.slots)
+}
@@ -0,0 +1,199 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/breaker"
+	"github.com/redis/go-redis/v9"
+)
+
+// Canal usado para propagar ajustes de configuração para as outras instâncias
+const ConfigChannel = "lb_config"
+
+// limite do contador de falhas/sucessos no bitmap do CircuitBreakerState
+const maxBreakerCount = 1023
+
+var ErrInvalidConfig = errors.New("invalid load balancer config")
+
+// Parâmetros ajustáveis em tempo de execução. Uma nova configuração substitui a
+// anterior por inteiro, então load balancer e circuit breakers nunca enxergam
+// uma combinação parcial de valores
+type Config struct {
+	CostWeight     float64 // 0 (custo irrelevante) até 0.99 (custo crítico)
+	LatencyLimit   time.Duration
+	RequestTimeout time.Duration
+	CircuitTimeout time.Duration
+	Breaker        breaker.CircuitBreakerCfg
+}
+
+func (c *Config) validate() error {
+	if c.CostWeight < 0 || c.CostWeight >= 1 {
+		return fmt.Errorf("%w: costWeight must be in [0, 1)", ErrInvalidConfig)
+	}
+
+	if c.LatencyLimit <= 0 || c.RequestTimeout <= 0 || c.CircuitTimeout <= 0 || c.Breaker.RecoveryTimeout <= 0 {
+		return fmt.Errorf("%w: durations must be positive", ErrInvalidConfig)
+	}
+
+	// resolução do openedAt do CircuitBreakerState
+	if c.Breaker.RecoveryTimeout < time.Millisecond {
+		return fmt.Errorf("%w: cbRecoveryTimeout must be at least 1ms", ErrInvalidConfig)
+	}
+
+	if c.Breaker.RecoveryAttempts < 1 || c.Breaker.RecoveryAttempts > maxBreakerCount {
+		return fmt.Errorf("%w: cbRecoveryAttempts must be in [1, 1023]", ErrInvalidConfig)
+	}
+
+	if c.Breaker.FailureThreshold < 1 || c.Breaker.FailureThreshold > maxBreakerCount {
+		return fmt.Errorf("%w: cbFailureThreshold must be in [1, 1023]", ErrInvalidConfig)
+	}
+
+	return nil
+}
+
+// Representação JSON da configuração, com durações no formato do time.ParseDuration
+type ConfigPayload struct {
+	CostWeight          float64 `json:"costWeight"`
+	LatencyLimit        string  `json:"latencyLimit"`
+	ProcessorReqTimeout string  `json:"processorReqTimeout"`
+	LBCircuitTimeout    string  `json:"lbCircuitTimeout"`
+	CBRecoveryTimeout   string  `json:"cbRecoveryTimeout"`
+	CBRecoveryAttempts  int     `json:"cbRecoveryAttempts"`
+	CBFailureThreshold  int     `json:"cbFailureThreshold"`
+}
+
+func (c Config) Payload() ConfigPayload {
+	return ConfigPayload{
+		CostWeight:          c.CostWeight,
+		LatencyLimit:        c.LatencyLimit.String(),
+		ProcessorReqTimeout: c.RequestTimeout.String(),
+		LBCircuitTimeout:    c.CircuitTimeout.String(),
+		CBRecoveryTimeout:   c.Breaker.RecoveryTimeout.String(),
+		CBRecoveryAttempts:  c.Breaker.RecoveryAttempts,
+		CBFailureThreshold:  c.Breaker.FailureThreshold,
+	}
+}
+
+// Atualização parcial: apenas os campos presentes são alterados
+type ConfigUpdate struct {
+	CostWeight          *float64 `json:"costWeight"`
+	LatencyLimit        *string  `json:"latencyLimit"`
+	ProcessorReqTimeout *string  `json:"processorReqTimeout"`
+	LBCircuitTimeout    *string  `json:"lbCircuitTimeout"`
+	CBRecoveryTimeout   *string  `json:"cbRecoveryTimeout"`
+	CBRecoveryAttempts  *int     `json:"cbRecoveryAttempts"`
+	CBFailureThreshold  *int     `json:"cbFailureThreshold"`
+}
+
+func parseDurationField(name string, value *string, dst *time.Duration) error {
+	if value == nil {
+		return nil
+	}
+
+	d, err := time.ParseDuration(*value)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, name, err)
+	}
+
+	*dst = d
+	return nil
+}
+
+// Aplica a atualização sobre uma cópia de c
+func (u ConfigUpdate) Apply(c Config) (Config, error) {
+	if u.CostWeight != nil {
+		c.CostWeight = *u.CostWeight
+	}
+	if u.CBRecoveryAttempts != nil {
+		c.Breaker.RecoveryAttempts = *u.CBRecoveryAttempts
+	}
+	if u.CBFailureThreshold != nil {
+		c.Breaker.FailureThreshold = *u.CBFailureThreshold
+	}
+
+	err := errors.Join(
+		parseDurationField("latencyLimit", u.LatencyLimit, &c.LatencyLimit),
+		parseDurationField("processorReqTimeout", u.ProcessorReqTimeout, &c.RequestTimeout),
+		parseDurationField("lbCircuitTimeout", u.LBCircuitTimeout, &c.CircuitTimeout),
+		parseDurationField("cbRecoveryTimeout", u.CBRecoveryTimeout, &c.Breaker.RecoveryTimeout),
+	)
+	if err != nil {
+		return c, err
+	}
+
+	return c, c.validate()
+}
+
+func (lb *LoadBalancer) Config() Config {
+	return *lb.config.Load()
+}
+
+// Aplica a atualização sobre a configuração atual. Atualizações concorrentes (ex: um
+// PATCH e o broadcast de outra instância) são refeitas sobre a versão mais recente,
+// então nenhuma delas sobrescreve os campos alterados pela outra
+func (lb *LoadBalancer) ApplyConfigUpdate(u ConfigUpdate) (Config, error) {
+	for {
+		current := lb.config.Load()
+
+		cfg, err := u.Apply(*current)
+		if err != nil {
+			return cfg, err
+		}
+
+		if lb.config.CompareAndSwap(current, &cfg) {
+			log.Printf("Load balancer config updated: %+v", cfg.Payload())
+			return cfg, nil
+		}
+	}
+}
+
+func (lb *LoadBalancer) CircuitTimeout() time.Duration {
+	return lb.config.Load().CircuitTimeout
+}
+
+func (lb *LoadBalancer) breakerConfig() *breaker.CircuitBreakerCfg {
+	return &lb.config.Load().Breaker
+}
+
+// Publica a configuração para as outras instâncias
+func PublishConfig(ctx context.Context, rc *redis.Client, cfg Config) error {
+	msg, err := json.Marshal(cfg.Payload())
+	if err != nil {
+		return err
+	}
+
+	return rc.Publish(ctx, ConfigChannel, msg).Err()
+}
+
+// Aplica as configurações publicadas por qualquer instância. A própria mensagem
+// também é recebida, o que é inofensivo já que o valor é o mesmo
+func (lb *LoadBalancer) ListenConfig(rc *redis.Client) {
+	sub := rc.Subscribe(context.Background(), ConfigChannel)
+	defer sub.Close()
+
+	for msg := range sub.Channel() {
+		var payload ConfigPayload
+		if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+			log.Printf("Error decoding load balancer config: %v", err)
+			continue
+		}
+
+		_, err := lb.ApplyConfigUpdate(ConfigUpdate{
+			CostWeight:          &payload.CostWeight,
+			LatencyLimit:        &payload.LatencyLimit,
+			ProcessorReqTimeout: &payload.ProcessorReqTimeout,
+			LBCircuitTimeout:    &payload.LBCircuitTimeout,
+			CBRecoveryTimeout:   &payload.CBRecoveryTimeout,
+			CBRecoveryAttempts:  &payload.CBRecoveryAttempts,
+			CBFailureThreshold:  &payload.CBFailureThreshold,
+		})
+		if err != nil {
+			log.Printf("Ignoring load balancer config: %v", err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package balancer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApplyConfigUpdateRejectsInvalidConfig(t *testing.T) {
+	lb := newTestLoadBalancer(t)
+	before := lb.Config()
+
+	recoveryTimeout := "500us"
+	if _, err := lb.ApplyConfigUpdate(ConfigUpdate{CBRecoveryTimeout: &recoveryTimeout}); !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+
+	if lb.Config() != before {
+		t.Fatal("invalid update must not change the config")
+	}
+}
+
+func TestApplyConfigUpdateKeepsConcurrentFields(t *testing.T) {
+	lb := newTestLoadBalancer(t)
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			costWeight := float64(i%10) / 100
+			lb.ApplyConfigUpdate(ConfigUpdate{CostWeight: &costWeight})
+		}()
+		go func() {
+			defer wg.Done()
+			recoveryTimeout := "1500ms"
+			lb.ApplyConfigUpdate(ConfigUpdate{CBRecoveryTimeout: &recoveryTimeout})
+		}()
+	}
+	wg.Wait()
+
+	if got := lb.Config().Breaker.RecoveryTimeout; got != 1500*time.Millisecond {
+		t.Fatalf("recovery timeout lost by a concurrent update: %v", got)
+	}
+}
@@ -0,0 +1,101 @@
+package balancer
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+)
+
+// Escolhe a réplica com a menor média móvel exponencial de latência. A latência do
+// fallback é inflada pelo custo e falhas contam como uma requisição que atingiu o timeout.
+// A média de uma réplica sem amostras recentes decai pela metade a cada halfLife, então
+// uma réplica preterida (ex: após uma sequência de falhas) volta a ser testada
+type ewmaStrategy struct {
+	lb              *LoadBalancer
+	alpha           float64
+	halfLife        time.Duration
+	defaultLatency  ewmaLatency
+	fallbackLatency ewmaLatency
+}
+
+// latência média em ns, armazenada como bits do float64, e o momento da última amostra
+type ewmaLatency struct {
+	value   atomic.Uint64
+	updated atomic.Int64
+}
+
+func (e *ewmaLatency) load(now time.Time, halfLife time.Duration) float64 {
+	return decay(math.Float64frombits(e.value.Load()), e.updated.Load(), now, halfLife)
+}
+
+func (e *ewmaLatency) observe(alpha, sample float64, now time.Time, halfLife time.Duration) {
+	for {
+		old := e.value.Load()
+
+		next := sample
+		if old != 0 {
+			current := decay(math.Float64frombits(old), e.updated.Load(), now, halfLife)
+			next = alpha*sample + (1-alpha)*current
+		}
+
+		if e.value.CompareAndSwap(old, math.Float64bits(next)) {
+			e.updated.Store(now.UnixNano())
+			return
+		}
+	}
+}
+
+func decay(value float64, updated int64, now time.Time, halfLife time.Duration) float64 {
+	elapsed := now.UnixNano() - updated
+	if value == 0 || elapsed <= 0 {
+		return value
+	}
+
+	return value * math.Exp2(-float64(elapsed)/float64(halfLife))
+}
+
+func newEWMAStrategy(lb *LoadBalancer) *ewmaStrategy {
+	alpha, err := strconv.ParseFloat(utils.Getenv("LB_EWMA_ALPHA", "0.3"), 64)
+	if err != nil || alpha <= 0 || alpha > 1 {
+		alpha = 0.3
+	}
+
+	return &ewmaStrategy{
+		lb:       lb,
+		alpha:    alpha,
+		halfLife: utils.GetenvDuration("LB_EWMA_HALF_LIFE", "5s"),
+	}
+}
+
+func (s *ewmaStrategy) latency(replica *Replica) *ewmaLatency {
+	if replica.Type == http.FallbackHost {
+		return &s.fallbackLatency
+	}
+
+	return &s.defaultLatency
+}
+
+func (s *ewmaStrategy) Select(defaultReplica, fallbackReplica *Replica) *Replica {
+	now := time.Now()
+	fallbackLatency := s.fallbackLatency.load(now, s.halfLife) / (1.0 - s.lb.config.Load().CostWeight)
+
+	// em caso de empate (ex: sem amostras) o default é priorizado
+	if s.defaultLatency.load(now, s.halfLife) <= fallbackLatency {
+		return defaultReplica
+	}
+
+	return fallbackReplica
+}
+
+func (s *ewmaStrategy) Observe(replica *Replica, responseTime int64) {
+	sample := float64(responseTime)
+	if responseTime < 0 {
+		sample = float64(s.lb.config.Load().RequestTimeout)
+	}
+
+	s.latency(replica).observe(s.alpha, sample, time.Now(), s.halfLife)
+}
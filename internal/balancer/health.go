@@ -0,0 +1,186 @@
+package balancer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Último service-health de cada processor, compartilhado entre as instâncias
+	HealthKeyPrefix = "processor_health:"
+	healthLeaderKey = HealthKeyPrefix + "leader"
+
+	// limite de chamadas ao service-health imposto pelos processors
+	minHealthInterval = 5 * time.Second
+)
+
+// Adquire ou renova a liderança do poller
+const acquireHealthLeaderLuaScript = `
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+
+return 0
+`
+
+var acquireHealthLeaderScript = redis.NewScript(acquireHealthLeaderLuaScript)
+
+// Consulta o service-health dos processors. Somente a instância que detém o lock no
+// redis faz as chamadas, respeitando o rate limit, e todas aplicam o resultado salvo no redis
+type HealthPoller struct {
+	enabled     bool
+	interval    time.Duration
+	instanceID  string
+	lb          *LoadBalancer
+	redisClient *redis.Client
+}
+
+func NewHealthPoller(lb *LoadBalancer, rc *redis.Client) *HealthPoller {
+	interval, _ := time.ParseDuration(utils.Getenv("HEALTH_CHECK_INTERVAL", "5s"))
+	if interval < minHealthInterval {
+		log.Printf("HEALTH_CHECK_INTERVAL %v below processors rate limit: using %v\n", interval, minHealthInterval)
+		interval = minHealthInterval
+	}
+
+	hostname, _ := os.Hostname()
+
+	return &HealthPoller{
+		enabled:     utils.Getenv("HEALTH_CHECK", "true") == "true",
+		interval:    interval,
+		instanceID:  utils.Getenv("INSTANCE_ID", hostname),
+		lb:          lb,
+		redisClient: rc,
+	}
+}
+
+func (p *HealthPoller) Start(ctx context.Context) {
+	if !p.enabled {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *HealthPoller) poll(ctx context.Context) {
+	if p.acquireLeader(ctx) {
+		for _, replica := range []*Replica{p.lb.DefaultReplica, p.lb.FallbackReplica} {
+			p.check(ctx, replica)
+		}
+	}
+
+	p.apply(ctx)
+}
+
+func (p *HealthPoller) acquireLeader(ctx context.Context) bool {
+	// expira antes do próximo ciclo de um novo líder caso esta instância pare
+	ttl := p.interval * 2
+
+	acquired, err := acquireHealthLeaderScript.Run(ctx, p.redisClient,
+		[]string{healthLeaderKey},
+		p.instanceID, ttl.Milliseconds(),
+	).Int()
+	if err != nil {
+		log.Printf("Failed to acquire health poller lock: %v\n", err)
+		return false
+	}
+
+	return acquired == 1
+}
+
+func (p *HealthPoller) check(ctx context.Context, replica *Replica) {
+	reqCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	health, err := p.lb.httpClient.ServiceHealth(reqCtx, replica.Type)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			log.Printf("Failed to check %v processor health: %v\n", replica.Type, err)
+		}
+		return
+	}
+
+	value, err := json.Marshal(health)
+	if err != nil {
+		return
+	}
+
+	// resultado antigo deixa de valer se o líder parar de atualizá-lo
+	if err := p.redisClient.Set(ctx, HealthKeyPrefix+string(replica.Type), value, p.interval*3).Err(); err != nil {
+		log.Printf("Failed to share %v processor health: %v\n", replica.Type, err)
+	}
+}
+
+func (p *HealthPoller) apply(ctx context.Context) {
+	replicas := []*Replica{p.lb.DefaultReplica, p.lb.FallbackReplica}
+
+	keys := make([]string, len(replicas))
+	for i, replica := range replicas {
+		keys[i] = HealthKeyPrefix + string(replica.Type)
+	}
+
+	values, err := p.redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		log.Printf("Failed to read processors health: %v\n", err)
+		return
+	}
+
+	for i, replica := range replicas {
+		raw, ok := values[i].(string)
+		if !ok {
+			replica.health.Store(nil)
+			continue
+		}
+
+		var health http.ServiceHealth
+		if err := json.Unmarshal([]byte(raw), &health); err != nil {
+			replica.health.Store(nil)
+			continue
+		}
+
+		p.lb.setHealth(replica, &health)
+	}
+}
+
+func (lb *LoadBalancer) setHealth(replica *Replica, health *http.ServiceHealth) {
+	previous := replica.health.Swap(health)
+
+	if health.Failing && (previous == nil || !previous.Failing) {
+		log.Printf("%v processor reported failing: opening circuit breaker\n", replica.Type)
+		replica.CircuitBreaker.Trip()
+	}
+}
+
+// Sem service-health conhecido a réplica é considerada saudável e só os circuit breakers decidem
+func (lb *LoadBalancer) healthy(replica *Replica) bool {
+	health := replica.health.Load()
+	if health == nil {
+		return true
+	}
+
+	minResponseTime := time.Duration(health.MinResponseTime) * time.Millisecond
+	return !health.Failing && minResponseTime < lb.config.Load().RequestTimeout
+}
@@ -2,6 +2,7 @@ package balancer
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/breaker"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
@@ -11,10 +12,38 @@ type ReplicaStats struct {
 	sync.RWMutex
 	LatencyAlpha float64
 	LatencyBeta  float64
+	priorAlpha   float64
+	priorBeta    float64
+	shared       bool    // LB_SHARED_STATS
+	pendingAlpha float64 // incrementos ainda não enviados para o redis
+	pendingBeta  float64
+}
+
+func newReplicaStats(alpha, beta float64, shared bool) *ReplicaStats {
+	return &ReplicaStats{
+		LatencyAlpha: alpha,
+		LatencyBeta:  beta,
+		priorAlpha:   alpha,
+		priorBeta:    beta,
+		shared:       shared,
+	}
+}
+
+func (s *ReplicaStats) add(alpha, beta float64) {
+	s.Lock()
+	s.LatencyAlpha += alpha
+	s.LatencyBeta += beta
+	if s.shared {
+		s.pendingAlpha += alpha
+		s.pendingBeta += beta
+	}
+	s.Unlock()
 }
 
 type Replica struct {
 	Type           http.HostType
 	Stats          *ReplicaStats
 	CircuitBreaker *breaker.CircuitBreaker
+	Bulkhead       *Bulkhead
+	health         atomic.Pointer[http.ServiceHealth] // último service-health conhecido, nil se indisponível
 }
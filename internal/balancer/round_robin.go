@@ -0,0 +1,75 @@
+package balancer
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+)
+
+// Weighted round-robin suave (mesmo algoritmo do nginx): com pesos 3 e 1 a sequência
+// é default, default, fallback, default em vez de agrupar as requisições de cada réplica
+type roundRobinStrategy struct {
+	mu              sync.Mutex
+	defaultWeight   int
+	fallbackWeight  int
+	defaultCurrent  int
+	fallbackCurrent int
+}
+
+func newRoundRobinStrategy() *roundRobinStrategy {
+	weights := utils.Getenv("LB_ROUND_ROBIN_WEIGHTS", "3,1")
+
+	defaultWeight, fallbackWeight, err := parseWeights(weights)
+	if err != nil {
+		log.Printf("Invalid LB_ROUND_ROBIN_WEIGHTS %q: using 3,1\n", weights)
+		defaultWeight, fallbackWeight = 3, 1
+	}
+
+	return &roundRobinStrategy{
+		defaultWeight:  defaultWeight,
+		fallbackWeight: fallbackWeight,
+	}
+}
+
+func parseWeights(value string) (defaultWeight, fallbackWeight int, err error) {
+	d, f, found := strings.Cut(value, ",")
+	if !found {
+		return 0, 0, strconv.ErrSyntax
+	}
+
+	if defaultWeight, err = strconv.Atoi(strings.TrimSpace(d)); err != nil {
+		return 0, 0, err
+	}
+
+	if fallbackWeight, err = strconv.Atoi(strings.TrimSpace(f)); err != nil {
+		return 0, 0, err
+	}
+
+	if defaultWeight < 0 || fallbackWeight < 0 || defaultWeight+fallbackWeight == 0 {
+		return 0, 0, strconv.ErrRange
+	}
+
+	return defaultWeight, fallbackWeight, nil
+}
+
+func (s *roundRobinStrategy) Select(defaultReplica, fallbackReplica *Replica) *Replica {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.defaultCurrent += s.defaultWeight
+	s.fallbackCurrent += s.fallbackWeight
+	total := s.defaultWeight + s.fallbackWeight
+
+	if s.defaultCurrent >= s.fallbackCurrent {
+		s.defaultCurrent -= total
+		return defaultReplica
+	}
+
+	s.fallbackCurrent -= total
+	return fallbackReplica
+}
+
+func (s *roundRobinStrategy) Observe(replica *Replica, responseTime int64) {}
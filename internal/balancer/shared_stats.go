@@ -0,0 +1,155 @@
+package balancer
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// Soma dos incrementos de alpha e beta de todas as instâncias, um hash por réplica
+const SharedStatsKeyPrefix = "lb_stats:"
+
+// Aplica o decaimento pelo tempo desde a última atualização e soma os incrementos de
+// uma instância. O seq de cada instância torna o envio idempotente: um lote reenviado
+// após uma falha que já tinha sido aplicada não é somado de novo. Retorna as somas
+// como string, já que o redis converte números do lua para inteiro
+const syncSharedStatsLuaScript = `
+local now = redis.call('TIME')
+now = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+local seqField = 'seq:' .. ARGV[5]
+local current = redis.call('HMGET', KEYS[1], 'alpha', 'beta', 'updated', seqField)
+local alpha = tonumber(current[1]) or 0
+local beta = tonumber(current[2]) or 0
+local updated = tonumber(current[3]) or now
+
+local factor = math.pow(2, -math.max(now - updated, 0) / tonumber(ARGV[3]))
+alpha = alpha * factor
+beta = beta * factor
+
+if (tonumber(current[4]) or 0) < tonumber(ARGV[6]) then
+	alpha = alpha + tonumber(ARGV[1])
+	beta = beta + tonumber(ARGV[2])
+	redis.call('HSET', KEYS[1], seqField, ARGV[6])
+end
+
+redis.call('HSET', KEYS[1], 'alpha', tostring(alpha), 'beta', tostring(beta), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+
+return {tostring(alpha), tostring(beta)}
+`
+
+var syncSharedStatsScript = redis.NewScript(syncSharedStatsLuaScript)
+
+// Incrementos enviados ao redis e ainda não confirmados
+type statsBatch struct {
+	seq   int64
+	alpha float64
+	beta  float64
+}
+
+// Compartilha as observações de latência entre as instâncias. Os incrementos locais são
+// somados no redis e cada instância passa a amostrar da distribuição formada pelo prior
+// e pelos incrementos de todo o cluster. As somas decaem pela metade a cada halfLife,
+// então as observações antigas perdem peso e os parâmetros não crescem sem limite
+type StatsSync struct {
+	enabled     bool
+	interval    time.Duration
+	halfLife    time.Duration
+	ttl         time.Duration
+	instanceID  string
+	seq         int64
+	inflight    map[*Replica]*statsBatch
+	lb          *LoadBalancer
+	redisClient *redis.Client
+}
+
+func NewStatsSync(lb *LoadBalancer, rc *redis.Client) *StatsSync {
+	interval := utils.GetenvDuration("LB_STATS_SYNC_INTERVAL", "1s")
+	hostname, _ := os.Hostname()
+
+	return &StatsSync{
+		enabled:  lb.sharedStats,
+		interval: interval,
+		halfLife: utils.GetenvDuration("LB_STATS_HALF_LIFE", "30s"),
+		// expira somente quando nenhuma instância está sincronizando, ex: após um restart de todo o cluster
+		ttl:        interval * 10,
+		instanceID: utils.Getenv("INSTANCE_ID", hostname),
+		// começa pelo horário (ms, exato nos números do lua) para continuar crescente
+		// após um restart com o mesmo INSTANCE_ID
+		seq:         time.Now().UnixMilli(),
+		inflight:    make(map[*Replica]*statsBatch),
+		lb:          lb,
+		redisClient: rc,
+	}
+}
+
+func (s *StatsSync) Start(ctx context.Context) {
+	if !s.enabled {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, replica := range []*Replica{s.lb.DefaultReplica, s.lb.FallbackReplica} {
+				s.sync(ctx, replica)
+			}
+		}
+	}
+}
+
+func (s *StatsSync) sync(ctx context.Context, replica *Replica) {
+	stats := replica.Stats
+
+	// um lote que falhou é reenviado com o mesmo seq antes de enviar novos incrementos,
+	// já que ele pode ter sido aplicado mesmo sem a resposta chegar
+	batch := s.inflight[replica]
+	if batch == nil {
+		s.seq++
+
+		stats.Lock()
+		batch = &statsBatch{seq: s.seq, alpha: stats.pendingAlpha, beta: stats.pendingBeta}
+		stats.pendingAlpha, stats.pendingBeta = 0, 0
+		stats.Unlock()
+	}
+
+	key := SharedStatsKeyPrefix + string(replica.Type)
+
+	res, err := syncSharedStatsScript.Run(ctx, s.redisClient, []string{key},
+		batch.alpha,
+		batch.beta,
+		s.halfLife.Milliseconds(),
+		s.ttl.Milliseconds(),
+		s.instanceID,
+		batch.seq,
+	).StringSlice()
+	if err != nil {
+		s.inflight[replica] = batch
+
+		if ctx.Err() == nil {
+			log.Printf("Failed to sync %v replica stats: %v\n", replica.Type, err)
+		}
+		return
+	}
+	delete(s.inflight, replica)
+
+	clusterAlpha, _ := strconv.ParseFloat(res[0], 64)
+	clusterBeta, _ := strconv.ParseFloat(res[1], 64)
+
+	// incrementos feitos durante a sincronização ainda não estão no total do cluster
+	stats.Lock()
+	stats.LatencyAlpha = stats.priorAlpha + clusterAlpha + stats.pendingAlpha
+	stats.LatencyBeta = stats.priorBeta + clusterBeta + stats.pendingBeta
+	stats.Unlock()
+}
@@ -0,0 +1,106 @@
+package balancer
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/breaker"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
+)
+
+// Contadores das requisições feitas aos payment-processors desde a última coleta
+type requestCounters struct {
+	requests   atomic.Int64
+	failures   atomic.Int64
+	latencySum atomic.Int64 // ns, somente requisições bem sucedidas
+}
+
+type RequestStats struct {
+	Requests   int64
+	Failures   int64
+	AvgLatency time.Duration
+}
+
+func (s RequestStats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+
+	return float64(s.Failures) / float64(s.Requests)
+}
+
+func (c *requestCounters) record(responseTime int64, err error) {
+	// circuito aberto não chegou a fazer a requisição e pagamento já processado não é falha do processor
+	if errors.Is(err, breaker.ErrCircuitOpen) || errors.Is(err, http.ErrAlreadyProcessed) {
+		return
+	}
+
+	c.requests.Add(1)
+	if err != nil {
+		c.failures.Add(1)
+		return
+	}
+
+	c.latencySum.Add(responseTime)
+}
+
+// Retorna as estatísticas acumuladas desde a última chamada e zera os contadores
+func (lb *LoadBalancer) CollectStats() RequestStats {
+	requests := lb.counters.requests.Swap(0)
+	failures := lb.counters.failures.Swap(0)
+	latencySum := lb.counters.latencySum.Swap(0)
+
+	stats := RequestStats{
+		Requests: requests,
+		Failures: failures,
+	}
+
+	if successes := requests - failures; successes > 0 {
+		stats.AvgLatency = time.Duration(latencySum / successes)
+	}
+
+	return stats
+}
+
+// Exporta os parâmetros das distribuições beta e o estado dos circuit breakers de cada réplica
+func (lb *LoadBalancer) RegisterMetrics(r *metrics.Registry) {
+	replicas := []*Replica{lb.DefaultReplica, lb.FallbackReplica}
+
+	collect := func(value func(replica *Replica) float64) func() []metrics.Sample {
+		return func() []metrics.Sample {
+			samples := make([]metrics.Sample, 0, len(replicas))
+			for _, replica := range replicas {
+				samples = append(samples, metrics.Sample{
+					LabelValues: []string{string(replica.Type)},
+					Value:       value(replica),
+				})
+			}
+
+			return samples
+		}
+	}
+
+	r.NewGaugeFunc("payment_proxy_replica_latency_alpha", "Alpha of the latency Beta distribution of each processor.", []string{"processor"},
+		collect(func(replica *Replica) float64 {
+			replica.Stats.RLock()
+			defer replica.Stats.RUnlock()
+			return replica.Stats.LatencyAlpha
+		}),
+	)
+
+	r.NewGaugeFunc("payment_proxy_replica_latency_beta", "Beta of the latency Beta distribution of each processor.", []string{"processor"},
+		collect(func(replica *Replica) float64 {
+			replica.Stats.RLock()
+			defer replica.Stats.RUnlock()
+			return replica.Stats.LatencyBeta
+		}),
+	)
+
+	r.NewGaugeFunc("payment_proxy_breaker_state", "Circuit breaker state of each processor (0: closed, 1: open, 2: half open).", []string{"processor"},
+		collect(func(replica *Replica) float64 {
+			return float64(replica.CircuitBreaker.State())
+		}),
+	)
+}
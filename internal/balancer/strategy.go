@@ -0,0 +1,87 @@
+package balancer
+
+import (
+	"log"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+const (
+	StrategyThompson     = "thompson"
+	StrategyEWMA         = "ewma"
+	StrategyRoundRobin   = "round_robin"
+	StrategyDefaultFirst = "default_first"
+)
+
+// Estratégia de escolha entre as réplicas. O load balancer só consulta a estratégia
+// quando os circuitos das duas réplicas estão fechados
+type SelectionStrategy interface {
+	Select(defaultReplica, fallbackReplica *Replica) *Replica
+	// Resultado de uma requisição para a réplica: tempo de resposta em ns, negativo em caso de falha
+	Observe(replica *Replica, responseTime int64)
+}
+
+func newSelectionStrategy(lb *LoadBalancer) SelectionStrategy {
+	name := utils.Getenv("LB_STRATEGY", StrategyThompson)
+
+	switch name {
+	case StrategyThompson:
+		return &thompsonStrategy{lb: lb}
+	case StrategyEWMA:
+		return newEWMAStrategy(lb)
+	case StrategyRoundRobin:
+		return newRoundRobinStrategy()
+	case StrategyDefaultFirst:
+		return defaultFirstStrategy{}
+	default:
+		log.Printf("Invalid LB_STRATEGY %q: using %q\n", name, StrategyThompson)
+		return &thompsonStrategy{lb: lb}
+	}
+}
+
+// Thompson sampling sobre as distribuições beta de latência de cada réplica,
+// com o score do fallback penalizado pelo custo
+type thompsonStrategy struct {
+	lb *LoadBalancer
+}
+
+func (s *thompsonStrategy) Select(defaultReplica, fallbackReplica *Replica) *Replica {
+	defaultReplica.Stats.RLock()
+	betaDefault := distuv.Beta{
+		Alpha: defaultReplica.Stats.LatencyAlpha,
+		Beta:  defaultReplica.Stats.LatencyBeta,
+	}
+	defaultReplica.Stats.RUnlock()
+
+	fallbackReplica.Stats.RLock()
+	betaFallback := distuv.Beta{
+		Alpha: fallbackReplica.Stats.LatencyAlpha,
+		Beta:  fallbackReplica.Stats.LatencyBeta,
+	}
+	fallbackReplica.Stats.RUnlock()
+
+	scoreDefault := betaDefault.Rand()
+	scoreFallback := betaFallback.Rand() * (1.0 - s.lb.config.Load().CostWeight)
+
+	if scoreDefault > scoreFallback {
+		// log.Println("Selected default replica")
+		return defaultReplica
+	}
+
+	// log.Println("Selected fallback replica")
+	return fallbackReplica
+}
+
+func (s *thompsonStrategy) Observe(replica *Replica, responseTime int64) {
+	s.lb.UpdateLatency(replica.Stats, responseTime)
+}
+
+// Sempre o default, o fallback só é usado quando o circuito do default está aberto
+type defaultFirstStrategy struct{}
+
+func (defaultFirstStrategy) Select(defaultReplica, fallbackReplica *Replica) *Replica {
+	return defaultReplica
+}
+
+func (defaultFirstStrategy) Observe(replica *Replica, responseTime int64) {}
@@ -17,6 +17,19 @@ const (
 	HalfOpen
 )
 
+func (s CircuitState) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
 var (
 	ErrCircuitOpen = errors.New("Circuit Breaker is open")
 )
@@ -32,12 +45,20 @@ type CircuitBreakerCfg struct {
 	FailureThreshold int // abrir circuito após este número de falhas
 }
 
-func NewCircuitBreaker(cfg *CircuitBreakerCfg) *CircuitBreaker {
+// Retorna a configuração atual. É consultada a cada uso para que ajustes em tempo
+// de execução sejam aplicados sem recriar o circuit breaker
+type ConfigSource func() *CircuitBreakerCfg
+
+func NewCircuitBreaker(host http.HostType, cfg ConfigSource) *CircuitBreaker {
 	return &CircuitBreaker{
-		state: NewCircuitBreakerState(cfg),
+		state: NewCircuitBreakerState(host, cfg),
 	}
 }
 
+func (cb *CircuitBreaker) State() CircuitState {
+	return cb.state.GetCircuitState()
+}
+
 func (cb *CircuitBreaker) AllowRequest() bool {
 	state := cb.state.GetCircuitState()
 	switch state {
@@ -67,17 +88,29 @@ func (cb *CircuitBreaker) updateState(success bool) {
 			return
 		}
 
-		if cb.state.TrySetOpenState() {
-			cb.CircuitOpen.Store(true)
+		cb.open()
+	}
+}
+
+func (cb *CircuitBreaker) open() {
+	if cb.state.TrySetOpenState() {
+		cb.CircuitOpen.Store(true)
+
+		// log.Println("Circuit breaker is open")
+		timer := time.NewTimer(cb.state.config().RecoveryTimeout)
+		go func() {
+			<-timer.C
+			// log.Println("Circuit breaker is allowing requests")
+			cb.CircuitOpen.Store(false)
+		}()
+	}
+}
 
-			// log.Println("Circuit breaker is open")
-			timer := time.NewTimer(time.Duration(cb.state.recoveryTimeout))
-			go func() {
-				<-timer.C
-				// log.Println("Circuit breaker is allowing requests")
-				cb.CircuitOpen.Store(false)
-			}()
-		}
+// Abre o circuito sem esperar pelas falhas, ex: processor reportando instabilidade.
+// A recuperação segue o fluxo normal via half-open
+func (cb *CircuitBreaker) Trip() {
+	if cb.state.GetCircuitState() != Open {
+		cb.open()
 	}
 }
 
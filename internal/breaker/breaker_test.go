@@ -0,0 +1,49 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+)
+
+func newTestBreaker(recoveryTimeout time.Duration) *CircuitBreaker {
+	cfg := &CircuitBreakerCfg{
+		RecoveryTimeout:  recoveryTimeout,
+		RecoveryAttempts: 1,
+		FailureThreshold: 1,
+	}
+
+	return NewCircuitBreaker(http.DefaultHost, func() *CircuitBreakerCfg { return cfg })
+}
+
+func TestSubSecondRecoveryTimeout(t *testing.T) {
+	cb := newTestBreaker(100 * time.Millisecond)
+
+	cb.Trip()
+	if !cb.CircuitOpen.Load() || cb.State() != Open {
+		t.Fatalf("expected open circuit after trip, got %v", cb.State())
+	}
+
+	if cb.AllowRequest() {
+		t.Fatal("expected request rejected before the recovery timeout")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if cb.CircuitOpen.Load() {
+		t.Fatal("expected CircuitOpen cleared after the recovery timeout")
+	}
+	if !cb.AllowRequest() || cb.State() != HalfOpen {
+		t.Fatalf("expected half open after the recovery timeout, got %v", cb.State())
+	}
+}
+
+func TestPackStateRoundTrip(t *testing.T) {
+	openedAt := time.Now().UnixMilli()
+
+	state, failure, success, gotOpenedAt := unpackState(packState(int(HalfOpen), maxFailureCount, 7, openedAt))
+	if CircuitState(state) != HalfOpen || failure != maxFailureCount || success != 7 || gotOpenedAt != openedAt {
+		t.Fatalf("unexpected unpacked state: %v %d %d %d", state, failure, success, gotOpenedAt)
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"log"
 	"sync/atomic"
 	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
 )
 
 const (
 	stateBits    = 2
 	failureBits  = 10
 	successBits  = 10
-	openedAtBits = 31 // unix seconds timestamp
+	openedAtBits = 42 // unix milliseconds timestamp
 
 	stateShift    = 0
 	failureShift  = stateShift + stateBits     // 2
@@ -28,23 +31,26 @@ const (
 )
 
 type CircuitBreakerState struct {
-	state            uint64 // bitmap
-	failureThreshold int
-	recoveryAttempts int
-	recoveryTimeout  int64
+	state  uint64 // bitmap
+	host   http.HostType
+	config ConfigSource
 }
 
-func NewCircuitBreakerState(cfg *CircuitBreakerCfg) *CircuitBreakerState {
+func NewCircuitBreakerState(host http.HostType, cfg ConfigSource) *CircuitBreakerState {
 	cbs := &CircuitBreakerState{
-		failureThreshold: cfg.FailureThreshold,
-		recoveryAttempts: cfg.RecoveryAttempts,
-		recoveryTimeout:  int64(cfg.RecoveryTimeout.Seconds()),
+		host:   host,
+		config: cfg,
 	}
 
 	cbs.setState(int(Closed), 0, 0, 0)
 	return cbs
 }
 
+// em ms, mesma resolução do openedAt
+func (cbs *CircuitBreakerState) recoveryTimeout() int64 {
+	return cbs.config().RecoveryTimeout.Milliseconds()
+}
+
 func packState(state, failure, success int, openedAt int64) uint64 {
 	if state > maxValidState {
 		log.Panicf("invalid circuit state: %d", state)
@@ -82,6 +88,10 @@ func (cbs *CircuitBreakerState) getState() (state, failureCount, successCount in
 	return unpackState(packed)
 }
 
+func (cbs *CircuitBreakerState) transitioned(to CircuitState) {
+	metrics.BreakerTransitions.With(string(cbs.host), to.String()).Inc()
+}
+
 func (cbs *CircuitBreakerState) GetCircuitState() CircuitState {
 	state, _, _, _ := cbs.getState()
 	return CircuitState(state)
@@ -95,9 +105,10 @@ func (cbs *CircuitBreakerState) TrySetOpenState() bool {
 		return true
 	}
 
-	newPacked := packState(int(Open), failureCount, successCount, time.Now().Unix())
+	newPacked := packState(int(Open), failureCount, successCount, time.Now().UnixMilli())
 	if atomic.CompareAndSwapUint64(&cbs.state, oldPacked, newPacked) {
 		// log.Println("CircuitBreaker::OPEN")
+		cbs.transitioned(Open)
 		return true
 	}
 
@@ -113,7 +124,7 @@ func (cbs *CircuitBreakerState) TrySetHalfOpenState() bool {
 		return false
 	}
 
-	if time.Now().Unix()-openedAt < cbs.recoveryTimeout {
+	if time.Now().UnixMilli()-openedAt < cbs.recoveryTimeout() {
 		// transição inválida
 		return false
 	}
@@ -121,6 +132,7 @@ func (cbs *CircuitBreakerState) TrySetHalfOpenState() bool {
 	newPacked := packState(int(HalfOpen), failureCount, 0, openedAt)
 	if atomic.CompareAndSwapUint64(&cbs.state, oldPacked, newPacked) {
 		// log.Println("CircuitBreaker::HALF_OPEN")
+		cbs.transitioned(HalfOpen)
 		return true
 	}
 
@@ -137,13 +149,16 @@ func (cbs *CircuitBreakerState) TryIncrementSuccess() bool {
 	}
 
 	newCount := min(successCount+1, maxSuccessCount)
-	if newCount >= cbs.recoveryAttempts {
+	if newCount >= cbs.config().RecoveryAttempts {
 		state = int(Closed)
 	}
 
 	newPacked := packState(state, failureCount, newCount, openedAt)
 	if atomic.CompareAndSwapUint64(&cbs.state, oldPacked, newPacked) {
 		// log.Println("CircuitBreaker::CLOSED")
+		if CircuitState(state) == Closed {
+			cbs.transitioned(Closed)
+		}
 		return true
 	}
 
@@ -160,13 +175,16 @@ func (cbs *CircuitBreakerState) TryIncrementFailure() bool {
 	}
 
 	newCount := min(failureCount+1, maxFailureCount)
-	if newCount >= cbs.failureThreshold {
+	if newCount >= cbs.config().FailureThreshold {
 		state = int(Open)
-		openedAt = time.Now().Unix()
+		openedAt = time.Now().UnixMilli()
 	}
 
 	newPacked := packState(state, newCount, successCount, openedAt)
 	if atomic.CompareAndSwapUint64(&cbs.state, oldPacked, newPacked) {
+		if CircuitState(state) == Open {
+			cbs.transitioned(Open)
+		}
 		return true
 	}
 
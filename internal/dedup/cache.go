@@ -0,0 +1,72 @@
+package dedup
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache local com tamanho fixo dos pagamentos já concluídos, evitando uma ida ao
+// redis para duplicatas recebidas pela própria instância. Ao encher, as entradas
+// mais antigas são descartadas
+type localCache struct {
+	sync.Mutex
+	entries map[string]int64 // expiração em ms
+	order   []string
+	next    int
+	size    int
+}
+
+func newLocalCache(size int) *localCache {
+	return &localCache{
+		entries: make(map[string]int64, size),
+		order:   make([]string, 0, size),
+		size:    size,
+	}
+}
+
+func (c *localCache) contains(key string) bool {
+	if c.size <= 0 {
+		return false
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	// entradas expiradas só saem do cache quando sua posição for reutilizada
+	expiresAt, ok := c.entries[key]
+	return ok && expiresAt >= time.Now().UnixMilli()
+}
+
+func (c *localCache) add(key string, ttl time.Duration) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	expiresAt := time.Now().Add(ttl).UnixMilli()
+	if _, ok := c.entries[key]; ok {
+		c.entries[key] = expiresAt
+		return
+	}
+
+	if len(c.order) < c.size {
+		c.order = append(c.order, key)
+	} else {
+		delete(c.entries, c.order[c.next])
+		c.order[c.next] = key
+		c.next = (c.next + 1) % c.size
+	}
+
+	c.entries[key] = expiresAt
+}
+
+func (c *localCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries = make(map[string]int64, c.size)
+	c.order = c.order[:0]
+	c.next = 0
+}
@@ -0,0 +1,136 @@
+package dedup
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const KeyPrefix = "dedup:"
+
+type Status int
+
+const (
+	// O pagamento ainda não foi visto e agora pertence ao worker
+	Claimed Status = iota
+	// Outro worker (desta ou de outra instância) está processando o pagamento
+	InFlight
+	// O pagamento já foi processado
+	Done
+)
+
+const (
+	stateProcessing = "processing"
+	stateDone       = "done"
+)
+
+// Reserva o pagamento somente se ele ainda não tiver sido reservado ou concluído.
+// A reserva expira após ARGV[2] ms, liberando pagamentos de instâncias que pararam
+const claimLuaScript = `
+local current = redis.call('GET', KEYS[1])
+if current then
+	return current
+end
+
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+
+return 'claimed'
+`
+
+var claimScript = redis.NewScript(claimLuaScript)
+
+// Só remove reservas em andamento, nunca um pagamento já concluído por outro worker
+const releaseLuaScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+
+return 0
+`
+
+var releaseScript = redis.NewScript(releaseLuaScript)
+
+// Deduplicação de pagamentos compartilhada entre as instâncias
+type Deduplicator struct {
+	ttl         time.Duration // por quanto tempo um pagamento concluído é lembrado
+	claimTTL    time.Duration
+	cache       *localCache
+	redisClient *redis.Client
+}
+
+func NewDeduplicator(rc *redis.Client) *Deduplicator {
+	// um TTL zerado faria o SET falhar e o Claim trataria todo pagamento como reservado
+	ttl := utils.GetenvDuration("DEDUP_TTL", "1h")
+	claimTTL := max(utils.GetenvDuration("DEDUP_CLAIM_TTL", "30s"), time.Millisecond)
+	cacheSize, _ := strconv.Atoi(utils.Getenv("DEDUP_LOCAL_CACHE_SIZE", "10000"))
+
+	return &Deduplicator{
+		ttl:         ttl,
+		claimTTL:    claimTTL,
+		cache:       newLocalCache(cacheSize),
+		redisClient: rc,
+	}
+}
+
+// Reserva o pagamento para processamento. Em caso de erro no redis o pagamento é
+// considerado reservado: o payment-processor também rejeita duplicatas
+func (d *Deduplicator) Claim(ctx context.Context, correlationID string) Status {
+	if d.cache.contains(correlationID) {
+		return Done
+	}
+
+	res, err := claimScript.Run(ctx, d.redisClient,
+		[]string{KeyPrefix + correlationID},
+		stateProcessing,
+		d.claimTTL.Milliseconds(),
+	).Text()
+	if err != nil {
+		log.Printf("Failed to claim payment %v: %v\n", correlationID, err)
+		return Claimed
+	}
+
+	switch res {
+	case stateDone:
+		d.cache.add(correlationID, d.ttl)
+		return Done
+	case stateProcessing:
+		return InFlight
+	default:
+		return Claimed
+	}
+}
+
+// Marca o pagamento como concluído, descartando futuras duplicatas até o fim do TTL
+func (d *Deduplicator) Complete(ctx context.Context, correlationID string) {
+	d.cache.add(correlationID, d.ttl)
+
+	if err := d.redisClient.Set(ctx, KeyPrefix+correlationID, stateDone, d.ttl).Err(); err != nil {
+		log.Printf("Failed to mark payment %v as done: %v\n", correlationID, err)
+	}
+}
+
+// Libera a reserva para que uma nova tentativa possa processar o pagamento
+func (d *Deduplicator) Release(ctx context.Context, correlationID string) {
+	err := releaseScript.Run(ctx, d.redisClient,
+		[]string{KeyPrefix + correlationID},
+		stateProcessing,
+	).Err()
+	if err != nil {
+		log.Printf("Failed to release payment %v: %v\n", correlationID, err)
+	}
+}
+
+// Limpa o cache local sempre que o endpoint de purge for acionado em qualquer instância
+func (d *Deduplicator) ListenPurge(channel string) {
+	sub := d.redisClient.Subscribe(context.Background(), channel)
+	defer sub.Close()
+
+	for range sub.Channel() {
+		d.cache.reset()
+		log.Println("Dedup cache purged")
+	}
+}
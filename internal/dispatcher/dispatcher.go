@@ -2,91 +2,225 @@ package dispatcher
 
 import (
 	"context"
+	"errors"
 	"log"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/balancer"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/dedup"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/queue"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/results"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/retry"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/tracker"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/worker"
 	"github.com/redis/go-redis/v9"
 )
 
-const workersLimit = 20
+var ErrDispatcherStopped = errors.New("dispatcher is not running")
+
+// Menor espera para tentar de novo um pagamento reservado por outro worker
+const minInFlightDelay = 10 * time.Millisecond
 
 type WorkDispatcher struct {
-	workerPool     chan chan *worker.Work
-	workers        [workersLimit]*worker.Worker
-	workQueueKey   string
-	loadBalancer   *balancer.LoadBalancer
-	redisClient    *redis.Client
-	circuitTimeout time.Duration
+	workerPool         chan chan *worker.Work
+	queue              queue.Queue
+	batchSize          int
+	stopLoop           context.CancelFunc
+	loopDone           chan struct{}
+	inFlight           sync.WaitGroup // works entregues aos workers e ainda não concluídos
+	running            atomic.Bool
+	workerCfg          *worker.WorkerCfg
+	nextWorkerID       int
+	poolSize           atomic.Int32
+	minWorkers         int
+	maxWorkers         int
+	poolInterval       time.Duration
+	poolErrorThreshold float64
+	loadBalancer       *balancer.LoadBalancer
+	redisClient        *redis.Client
 }
 
-func NewWorkDispatcher(lb *balancer.LoadBalancer, rc *redis.Client, rh *worker.ResultsHandler) *WorkDispatcher {
+func NewWorkDispatcher(lb *balancer.LoadBalancer, rc *redis.Client, rs results.Store, t *tracker.Tracker, dlq *worker.DeadLetterQueue, q queue.Queue) *WorkDispatcher {
+	minWorkers, _ := strconv.Atoi(utils.Getenv("MIN_WORKERS", "2"))
 	maxWorkers, _ := strconv.Atoi(utils.Getenv("MAX_WORKERS", "10"))
-	if maxWorkers > workersLimit {
-		maxWorkers = workersLimit
-	}
+	minWorkers = max(minWorkers, 1)
+	maxWorkers = max(maxWorkers, minWorkers)
+
+	poolInterval := utils.GetenvDuration("WORKERS_ADJUST_INTERVAL", "1s")
+	poolErrorThreshold, _ := strconv.ParseFloat(utils.Getenv("WORKERS_ERROR_THRESHOLD", "0.5"), 64)
 
-	circuitTimeout, _ := time.ParseDuration(utils.Getenv("LB_CIRCUIT_TIMEOUT", "500ms"))
+	maxAttempts, err := strconv.Atoi(utils.Getenv("MAX_PROCESSING_ATTEMPTS", "20"))
+	if err != nil || maxAttempts < 1 {
+		log.Printf("Invalid MAX_PROCESSING_ATTEMPTS: using 20\n")
+		maxAttempts = 20
+	}
+	batchSize, _ := strconv.Atoi(utils.Getenv("DISPATCHER_BATCH_SIZE", "10"))
+	// sem espera a duplicata voltaria direto para a fila, em loop
+	inFlightDelay := utils.GetenvDuration("DEDUP_IN_FLIGHT_DELAY", "1s")
+	if inFlightDelay < minInFlightDelay {
+		log.Printf("DEDUP_IN_FLIGHT_DELAY %v too low: using %v\n", inFlightDelay, minInFlightDelay)
+		inFlightDelay = minInFlightDelay
+	}
 
 	wd := &WorkDispatcher{
-		workQueueKey:   "work_queue",
-		workerPool:     make(chan chan *worker.Work, maxWorkers),
-		loadBalancer:   lb,
-		redisClient:    rc,
-		circuitTimeout: circuitTimeout,
+		queue:              q,
+		batchSize:          max(batchSize, 1),
+		minWorkers:         minWorkers,
+		maxWorkers:         maxWorkers,
+		poolInterval:       poolInterval,
+		poolErrorThreshold: poolErrorThreshold,
+		workerPool:         make(chan chan *worker.Work, maxWorkers),
+		loadBalancer:       lb,
+		redisClient:        rc,
 	}
 
-	ws := worker.NewWorkStore()
-
-	for i := range maxWorkers {
-		worker := worker.NewWorker(
-			i,
-			wd.workerPool,
-			wd.workQueueKey,
-			ws,
-			lb,
-			rc,
-			rh,
-		)
-
-		wd.workers[i] = worker
-		worker.Start()
+	deduplicator := dedup.NewDeduplicator(rc)
+	go deduplicator.ListenPurge(worker.PurgeChannel)
+
+	wd.workerCfg = &worker.WorkerCfg{
+		WorkerPool:    wd.workerPool,
+		Queue:         q,
+		MaxAttempts:   maxAttempts,
+		Dedup:         deduplicator,
+		InFlightDelay: inFlightDelay,
+		InFlight:      &wd.inFlight,
+		LoadBalancer:  lb,
+		RedisClient:   rc,
+		Results:       rs,
+		Tracker:       t,
+		DeadLetters:   dlq,
+		Backoff:       retry.NewBackoff(),
 	}
-	log.Printf("%d workers have been registered\n", maxWorkers)
+
+	// a pool começa no mínimo e é ajustada conforme a carga
+	wd.addWorkers(minWorkers)
+	log.Printf("%d workers have been registered (min: %d | max: %d)\n", minWorkers, minWorkers, maxWorkers)
 
 	return wd
 }
 
 func (wd *WorkDispatcher) Start() {
 	log.Println("Starting dispatcher")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wd.stopLoop = cancel
+	wd.loopDone = make(chan struct{})
+
+	wd.running.Store(true)
+
+	go wd.adjustPool(ctx)
+	go wd.dispatchLoop(ctx)
+}
+
+// Pronto enquanto o loop de consumo da fila estiver rodando
+func (wd *WorkDispatcher) Ready(ctx context.Context) error {
+	if !wd.running.Load() {
+		return ErrDispatcherStopped
+	}
+
+	return nil
+}
+
+// Para de consumir a fila, devolve para ela os works que estavam no buffer local e
+// aguarda os works em andamento até o contexto expirar. Works que não terminarem
+// continuam reservados na fila e são recuperados por ela
+func (wd *WorkDispatcher) Stop(ctx context.Context) {
+	if wd.stopLoop == nil {
+		return
+	}
+
+	wd.stopLoop()
+	<-wd.loopDone
+
+	drained := make(chan struct{})
 	go func() {
-		for {
-			if !wd.loadBalancer.AllowWork() {
-				log.Printf("Dispatcher will sleep for %v: Load balancer circuit is open", wd.circuitTimeout)
-				time.Sleep(wd.circuitTimeout)
-				continue
+		wd.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Println("Dispatcher stopped: all in flight works finished")
+	case <-ctx.Done():
+		log.Println("Dispatcher stopped: shutdown deadline reached with works in flight")
+	}
+}
+
+func (wd *WorkDispatcher) dispatchLoop(ctx context.Context) {
+	defer close(wd.loopDone)
+	defer wd.running.Store(false)
+
+	buffer := make([][]byte, 0, wd.batchSize)
+
+	for {
+		if ctx.Err() != nil {
+			wd.flushBuffer(buffer)
+			return
+		}
+
+		if !wd.loadBalancer.AllowWork() {
+			circuitTimeout := wd.loadBalancer.CircuitTimeout()
+			log.Printf("Dispatcher will sleep for %v: Load balancer circuit is open", circuitTimeout)
+			select {
+			case <-time.After(circuitTimeout):
+			case <-ctx.Done():
 			}
+			continue
+		}
 
-			res, err := wd.redisClient.BLPop(context.Background(), 1*time.Second, wd.workQueueKey).Result()
+		if len(buffer) == 0 {
+			// lote do tamanho da quantidade de workers ociosos no momento
+			idleWorkers := len(wd.workerPool)
+			items, err := wd.queue.DequeueBatch(ctx, min(max(idleWorkers, 1), wd.batchSize), 1*time.Second)
 			if err != nil {
-				if err != redis.Nil {
-					log.Printf("Redis error when consuming from work_queue. error: %s\n", err)
+				if ctx.Err() == nil {
+					log.Printf("Error when consuming from work_queue. error: %s\n", err)
 				}
 				continue
 			}
 
-			payload := []byte(res[1])
+			if len(items) == 0 {
+				continue
+			}
 
-			// bloqueia até ter algum worker disponível
-			chWorker := <-wd.workerPool
+			buffer = append(buffer, items...)
+		}
 
+		// bloqueia até ter algum worker disponível
+		waitStart := time.Now()
+		select {
+		case chWorker := <-wd.workerPool:
+			metrics.DispatcherWait.Observe(time.Since(waitStart).Seconds())
+			wd.inFlight.Add(1)
 			chWorker <- &worker.Work{
-				Raw: payload,
+				Raw: buffer[0],
 			}
+			buffer = buffer[1:]
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Devolve os works do buffer para o início da fila, mantendo a ordem original
+func (wd *WorkDispatcher) flushBuffer(buffer [][]byte) {
+	if len(buffer) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
 
+	for i := len(buffer) - 1; i >= 0; i-- {
+		if err := wd.queue.Requeue(ctx, buffer[i], buffer[i], 0); err != nil {
+			log.Printf("Failed to flush %d buffered works back to work_queue: %v\n", i+1, err)
+			return
 		}
-	}()
+	}
+
+	log.Printf("Flushed %d buffered works back to work_queue\n", len(buffer))
 }
@@ -0,0 +1,106 @@
+package dispatcher
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/balancer"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/worker"
+)
+
+// Qtd mínima de requisições na janela para a taxa de erro ser considerada
+const minErrorSample = 10
+
+func (wd *WorkDispatcher) addWorkers(n int) {
+	for range n {
+		w := worker.NewWorker(wd.nextWorkerID, wd.workerCfg)
+		wd.nextWorkerID++
+		w.Start()
+	}
+
+	wd.poolSize.Add(int32(n))
+}
+
+// Remove até n workers ociosos. Workers ocupados terminam o work atual e continuam na pool
+func (wd *WorkDispatcher) removeWorkers(n int) int {
+	removed := 0
+	for range n {
+		select {
+		case chWorker := <-wd.workerPool:
+			chWorker <- nil
+			removed++
+		default:
+			wd.poolSize.Add(-int32(removed))
+			return removed
+		}
+	}
+
+	wd.poolSize.Add(-int32(removed))
+	return removed
+}
+
+// Tamanho da pool calculado pela lei de Little: demanda (req/s) x latência média
+func (wd *WorkDispatcher) targetPoolSize(size int, stats balancer.RequestStats, depth int64, idle int) int {
+	// processors falhando: mais concorrência só aumenta a pressão sobre eles
+	if !wd.loadBalancer.AllowWork() ||
+		(stats.Requests >= minErrorSample && stats.ErrorRate() >= wd.poolErrorThreshold) {
+		return size / 2
+	}
+
+	if stats.AvgLatency == 0 {
+		if depth > 0 && idle == 0 {
+			return size + 1
+		}
+		return size
+	}
+
+	demand := float64(stats.Requests+depth) / wd.poolInterval.Seconds()
+	target := int(math.Ceil(demand * stats.AvgLatency.Seconds()))
+
+	// reduz aos poucos para não oscilar entre janelas
+	if target < size {
+		return size - max(1, (size-target)/2)
+	}
+
+	return target
+}
+
+func (wd *WorkDispatcher) adjustPool(ctx context.Context) {
+	ticker := time.NewTicker(wd.poolInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := wd.loadBalancer.CollectStats()
+
+		depth, err := wd.queue.Depth(ctx)
+		if err != nil {
+			depth = 0
+		}
+
+		size := int(wd.poolSize.Load())
+		target := wd.targetPoolSize(size, stats, depth, len(wd.workerPool))
+		target = min(max(target, wd.minWorkers), wd.maxWorkers)
+
+		switch {
+		case target > size:
+			wd.addWorkers(target - size)
+		case target < size:
+			target = size - wd.removeWorkers(size-target)
+		default:
+			continue
+		}
+
+		log.Printf(
+			"Worker pool resized from %d to %d (queue: %d | latency: %v | error rate: %.2f)\n",
+			size, target, depth, stats.AvgLatency, stats.ErrorRate(),
+		)
+	}
+}
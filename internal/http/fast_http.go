@@ -2,12 +2,14 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
 	"github.com/valyala/fasthttp"
 )
 
@@ -22,11 +24,14 @@ const (
 var (
 	ErrAlreadyProcessed    = errors.New("Request has already been processed")
 	ErrInternalServerError = errors.New("Server responded with status 500")
+	ErrClientError         = errors.New("Server rejected the request")
+	ErrRateLimited         = errors.New("Server rate limit exceeded")
 )
 
 type HTTPHost struct {
-	client  *fasthttp.HostClient
-	postURI *fasthttp.URI
+	client    *fasthttp.HostClient
+	postURI   *fasthttp.URI
+	healthURI *fasthttp.URI
 }
 
 type FastHTTPClient struct {
@@ -35,8 +40,15 @@ type FastHTTPClient struct {
 }
 
 type HostCfg struct {
-	Addr     string
-	Endpoint string
+	Addr           string
+	Endpoint       string
+	HealthEndpoint string
+}
+
+// Resposta do GET /payments/service-health dos processors
+type ServiceHealth struct {
+	Failing         bool  `json:"failing"`
+	MinResponseTime int64 `json:"minResponseTime"` // ms
 }
 
 func NewFastHTTPClient(defaultCfg *HostCfg, fallbackCfg *HostCfg) *FastHTTPClient {
@@ -46,35 +58,50 @@ func NewFastHTTPClient(defaultCfg *HostCfg, fallbackCfg *HostCfg) *FastHTTPClien
 	fallbackPostURI := fasthttp.AcquireURI()
 	fallbackPostURI.Parse(nil, []byte(fallbackCfg.Endpoint))
 
+	defaultHealthURI := fasthttp.AcquireURI()
+	defaultHealthURI.Parse(nil, []byte(defaultCfg.HealthEndpoint))
+
+	fallbackHealthURI := fasthttp.AcquireURI()
+	fallbackHealthURI.Parse(nil, []byte(fallbackCfg.HealthEndpoint))
+
 	return &FastHTTPClient{
 		// docs: https://github.com/valyala/fasthttp/blob/dab027680cc57d7c2749ba018a72f8b943f473cc/client.go#L265
 		defaultHost: &HTTPHost{
-			client:  &fasthttp.HostClient{Addr: defaultCfg.Addr, MaxConns: 2048},
-			postURI: defaultPostURI,
+			client:    &fasthttp.HostClient{Addr: defaultCfg.Addr, MaxConns: 2048},
+			postURI:   defaultPostURI,
+			healthURI: defaultHealthURI,
 		},
 		fallbackHost: &HTTPHost{
-			client:  &fasthttp.HostClient{Addr: fallbackCfg.Addr, MaxConns: 2048},
-			postURI: fallbackPostURI,
+			client:    &fasthttp.HostClient{Addr: fallbackCfg.Addr, MaxConns: 2048},
+			postURI:   fallbackPostURI,
+			healthURI: fallbackHealthURI,
 		},
 	}
 }
 
+// O deadline do ctx é aplicado na própria conexão, então a chamada só retorna quando a
+// requisição terminou ou foi abortada. Assim o bulkhead conta as requisições que ainda
+// ocupam o processor e req/resp podem ser liberados com segurança
 func doWithContext(ctx context.Context, host *HTTPHost, req *fasthttp.Request, resp *fasthttp.Response) error {
-	done := make(chan error, 1)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	go func() {
-		done <- host.client.Do(req, resp)
-	}()
+	var err error
+	if deadline, ok := ctx.Deadline(); ok {
+		err = host.client.DoDeadline(req, resp, deadline)
+	} else {
+		err = host.client.Do(req, resp)
+	}
 
-	select {
-	case err := <-done:
-		if err != nil {
-			log.Printf("HTTP client error: %s\n", err.Error())
-		}
-		return err
-	case <-ctx.Done():
-		return ctx.Err()
+	if errors.Is(err, fasthttp.ErrTimeout) || errors.Is(err, fasthttp.ErrDialTimeout) {
+		return context.DeadlineExceeded
+	}
+	if err != nil {
+		log.Printf("HTTP client error: %s\n", err.Error())
 	}
+
+	return err
 }
 
 func (c *FastHTTPClient) getHost(hostType HostType) (*HTTPHost, error) {
@@ -93,12 +120,18 @@ func (c *FastHTTPClient) Close() {
 		if c.defaultHost.postURI != nil {
 			fasthttp.ReleaseURI(c.defaultHost.postURI)
 		}
+		if c.defaultHost.healthURI != nil {
+			fasthttp.ReleaseURI(c.defaultHost.healthURI)
+		}
 	}
 
 	if c.fallbackHost != nil {
 		if c.fallbackHost.postURI != nil {
 			fasthttp.ReleaseURI(c.fallbackHost.postURI)
 		}
+		if c.fallbackHost.healthURI != nil {
+			fasthttp.ReleaseURI(c.fallbackHost.healthURI)
+		}
 	}
 }
 
@@ -123,24 +156,73 @@ func (c *FastHTTPClient) POST(ctx context.Context, host HostType, body []byte) (
 
 	fasthttp.ReleaseRequest(req)
 
+	outcome := "error"
+	defer func() {
+		metrics.ProcessorRequests.With(string(host), outcome).Observe(float64(responseTime) / float64(time.Second))
+	}()
+
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			outcome = "timeout"
+		}
 		return 0, err
 	}
 
 	respStatus := res.StatusCode()
 	if respStatus >= 200 && respStatus < 300 {
+		outcome = "success"
 		return responseTime, nil
 	}
 
 	if res.StatusCode() == http.StatusUnprocessableEntity {
 		log.Println("***************ALREADY PROCESSED***************")
+		outcome = "already_processed"
 		return 0, ErrAlreadyProcessed
 	}
 
 	if respStatus == http.StatusInternalServerError {
+		outcome = "server_error"
 		return 0, ErrInternalServerError
 	}
 
 	log.Printf("RESPONSE ERROR STATUS: %v\n", respStatus)
+
+	// 408 e 429 são temporários, as demais respostas 4xx não vão mudar com uma nova tentativa
+	if respStatus >= 400 && respStatus < 500 && respStatus != http.StatusRequestTimeout && respStatus != http.StatusTooManyRequests {
+		outcome = "client_error"
+		return 0, fmt.Errorf("%w: POST request failed with status %v", ErrClientError, respStatus)
+	}
+
 	return 0, fmt.Errorf("POST request failed with status %v", respStatus)
 }
+
+func (c *FastHTTPClient) ServiceHealth(ctx context.Context, host HostType) (*ServiceHealth, error) {
+	httpHost, err := c.getHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	// fora do pool: em caso de timeout a requisição ainda pode estar em uso pelo client
+	req := &fasthttp.Request{}
+	req.SetURI(httpHost.healthURI)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	res := &fasthttp.Response{}
+
+	if err := doWithContext(ctx, httpHost, req, res); err != nil {
+		return nil, err
+	}
+
+	switch respStatus := res.StatusCode(); {
+	case respStatus == http.StatusTooManyRequests:
+		return nil, ErrRateLimited
+	case respStatus < 200 || respStatus >= 300:
+		return nil, fmt.Errorf("GET service-health failed with status %v", respStatus)
+	}
+
+	var health ServiceHealth
+	if err := json.Unmarshal(res.Body(), &health); err != nil {
+		return nil, err
+	}
+
+	return &health, nil
+}
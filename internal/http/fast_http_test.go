@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPOSTTimeoutAbortsRequest(t *testing.T) {
+	aborted := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// o contexto só é cancelado pelo fechamento da conexão após ler o body
+		io.ReadAll(r.Body)
+
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+			close(aborted)
+		}
+	}))
+	defer srv.Close()
+
+	hostCfg := &HostCfg{
+		Addr:     strings.TrimPrefix(srv.URL, "http://"),
+		Endpoint: srv.URL + "/payments",
+	}
+	client := NewFastHTTPClient(hostCfg, hostCfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.POST(ctx, DefaultHost, []byte(`{}`))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("POST returned after %v, expected it to stop at the deadline", elapsed)
+	}
+
+	// a conexão é fechada no deadline, então o processor deixa de contar essa requisição
+	select {
+	case <-aborted:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("expected the request to be aborted at the deadline")
+	}
+}
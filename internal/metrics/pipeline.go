@@ -0,0 +1,52 @@
+package metrics
+
+// Métricas do fluxo de um pagamento, do servidor até o registro do resultado
+var (
+	IngressRequests = Default.NewCounterVec(
+		"payment_proxy_ingress_requests_total",
+		"HTTP requests handled by the payment proxy.",
+		"route", "code",
+	)
+
+	IngressDuration = Default.NewHistogramVec(
+		"payment_proxy_ingress_request_duration_seconds",
+		"Time spent handling HTTP requests.",
+		DefaultBuckets,
+		"route",
+	)
+
+	DispatcherWait = Default.NewHistogram(
+		"payment_proxy_dispatcher_worker_wait_seconds",
+		"Time the work dispatcher waited for an idle worker.",
+		DefaultBuckets,
+	)
+
+	ProcessorRequests = Default.NewHistogramVec(
+		"payment_proxy_processor_request_duration_seconds",
+		"Latency of requests to the payment processors by outcome.",
+		DefaultBuckets,
+		"processor", "outcome",
+	)
+
+	BreakerTransitions = Default.NewCounterVec(
+		"payment_proxy_breaker_transitions_total",
+		"Circuit breaker state transitions by target state.",
+		"processor", "state",
+	)
+
+	Retries = Default.NewCounterVec(
+		"payment_proxy_retries_total",
+		"Payment retries scheduled by failure class.",
+		"class",
+	)
+
+	DeadLetters = Default.NewCounter(
+		"payment_proxy_dead_letters_total",
+		"Payments moved to the dead letter queue.",
+	)
+
+	ResultsPublishFailures = Default.NewCounter(
+		"payment_proxy_results_publish_failures_total",
+		"Processed payments whose result could not be recorded.",
+	)
+)
@@ -0,0 +1,344 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Buckets padrão em segundos, do tempo de um acesso ao redis até o timeout dos processors
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registro das métricas expostas no formato texto do Prometheus
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Séries de uma métrica indexadas pelos valores dos labels
+type family[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	create func() *T
+	mu     sync.RWMutex
+	series map[string]*T
+	values map[string][]string
+}
+
+func newFamily[T any](name, help, kind string, labels []string, create func() *T) *family[T] {
+	return &family[T]{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		create: create,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+	}
+}
+
+func (f *family[T]) with(values []string) *T {
+	if len(values) != len(f.labels) {
+		panic("metrics: " + f.name + " expects " + strconv.Itoa(len(f.labels)) + " label values")
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s, ok = f.series[key]; !ok {
+		s = f.create()
+		f.series[key] = s
+		f.values[key] = append([]string(nil), values...)
+	}
+
+	return s
+}
+
+// Percorre as séries em ordem para a saída ser estável entre coletas
+func (f *family[T]) each(fn func(labels string, s *T)) {
+	f.mu.RLock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	series := make([]*T, len(keys))
+	labels := make([]string, len(keys))
+	for i, key := range keys {
+		series[i] = f.series[key]
+		labels[i] = formatLabels(f.labels, f.values[key])
+	}
+	f.mu.RUnlock()
+
+	for i := range series {
+		fn(labels[i], series[i])
+	}
+}
+
+func (f *family[T]) writeHeader(w *bufio.Writer) {
+	w.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+}
+
+type Counter struct {
+	value atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.value.Add(n)
+}
+
+type CounterVec struct {
+	family *family[Counter]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		family: newFamily(name, help, "counter", labels, func() *Counter { return &Counter{} }),
+	}
+
+	r.register(c)
+	return c
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.family.with(values)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.family.writeHeader(w)
+	c.family.each(func(labels string, s *Counter) {
+		writeSample(w, c.family.name, labels, float64(s.value.Load()))
+	})
+}
+
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64 // não acumulados, o último é o +Inf
+	sum     atomic.Uint64   // bits do float64
+	count   atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Uint64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.counts[sort.SearchFloat64s(h.buckets, value)].Add(1)
+	h.count.Add(1)
+
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+value)) {
+			return
+		}
+	}
+}
+
+type HistogramVec struct {
+	family  *family[Histogram]
+	buckets []float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		family:  newFamily(name, help, "histogram", labels, func() *Histogram { return newHistogram(buckets) }),
+		buckets: buckets,
+	}
+
+	r.register(h)
+	return h
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.family.with(values)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.family.writeHeader(w)
+	h.family.each(func(labels string, s *Histogram) {
+		var cumulative uint64
+		for i, bound := range s.buckets {
+			cumulative += s.counts[i].Load()
+			writeSample(w, h.family.name+"_bucket", withLabel(labels, "le", formatFloat(bound)), float64(cumulative))
+		}
+		cumulative += s.counts[len(s.buckets)].Load()
+		writeSample(w, h.family.name+"_bucket", withLabel(labels, "le", "+Inf"), float64(cumulative))
+		writeSample(w, h.family.name+"_sum", labels, math.Float64frombits(s.sum.Load()))
+		writeSample(w, h.family.name+"_count", labels, float64(s.count.Load()))
+	})
+}
+
+// Valor de uma série de gauge, na ordem dos labels da métrica
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// Gauge calculado no momento da coleta
+type GaugeFunc struct {
+	name    string
+	help    string
+	labels  []string
+	collect func() []Sample
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func() []Sample) {
+	r.register(&GaugeFunc{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		collect: collect,
+	})
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	w.WriteString("# HELP " + g.name + " " + escapeHelp(g.help) + "\n")
+	w.WriteString("# TYPE " + g.name + " gauge\n")
+
+	for _, sample := range g.collect() {
+		if len(sample.LabelValues) != len(g.labels) {
+			continue
+		}
+		writeSample(w, g.name, formatLabels(g.labels, sample.LabelValues), sample.Value)
+	}
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatLabels(names, values []string) string {
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name + `="` + escapeLabel(values[i]) + `"`)
+	}
+
+	return sb.String()
+}
+
+func withLabel(labels, name, value string) string {
+	if labels == "" {
+		return name + `="` + value + `"`
+	}
+
+	return labels + "," + name + `="` + value + `"`
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(value string) string {
+	return labelReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
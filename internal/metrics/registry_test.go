@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+
+	var sb strings.Builder
+	if _, err := r.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	return sb.String()
+}
+
+func assertOutput(t *testing.T, got, want string) {
+	t.Helper()
+
+	if got != want {
+		t.Fatalf("unexpected output\n--- got\n%s--- want\n%s", got, want)
+	}
+}
+
+func TestCounterOutput(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounterVec("requests_total", "Requests by route.\nSecond line with \\.", "route", "status")
+	requests.With("/payments", "204").Add(3)
+	requests.With("/payments", "500").Inc()
+	requests.With(`say "hi"`+"\n"+`C:\tmp`, "200").Inc()
+
+	r.NewCounter("purges_total", "Purges.").Inc()
+
+	assertOutput(t, render(t, r), `# HELP requests_total Requests by route.\nSecond line with \\.
+# TYPE requests_total counter
+requests_total{route="/payments",status="204"} 3
+requests_total{route="/payments",status="500"} 1
+requests_total{route="say \"hi\"\nC:\\tmp",status="200"} 1
+# HELP purges_total Purges.
+# TYPE purges_total counter
+purges_total 1
+`)
+}
+
+func TestGaugeFuncOutput(t *testing.T) {
+	r := NewRegistry()
+
+	r.NewGaugeFunc("queue_depth", "Entries in the queue.", []string{"queue"}, func() []Sample {
+		return []Sample{
+			{LabelValues: []string{"work"}, Value: 42},
+			{LabelValues: []string{"retry"}, Value: 0.5},
+			// quantidade de labels inválida é ignorada
+			{LabelValues: []string{"a", "b"}, Value: 1},
+		}
+	})
+
+	assertOutput(t, render(t, r), `# HELP queue_depth Entries in the queue.
+# TYPE queue_depth gauge
+queue_depth{queue="work"} 42
+queue_depth{queue="retry"} 0.5
+`)
+}
+
+func TestHistogramOutput(t *testing.T) {
+	r := NewRegistry()
+
+	// buckets fora de ordem são ordenados
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "host")
+	h := latency.With("default")
+	h.Observe(0.05)
+	h.Observe(0.1) // no limite conta no bucket
+	h.Observe(0.5)
+	h.Observe(3)
+
+	r.NewHistogram("wait_seconds", "Wait.", []float64{0.25})
+
+	assertOutput(t, render(t, r), `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{host="default",le="0.1"} 2
+latency_seconds_bucket{host="default",le="1"} 3
+latency_seconds_bucket{host="default",le="+Inf"} 4
+latency_seconds_sum{host="default"} 3.65
+latency_seconds_count{host="default"} 4
+# HELP wait_seconds Wait.
+# TYPE wait_seconds histogram
+wait_seconds_bucket{le="0.25"} 0
+wait_seconds_bucket{le="+Inf"} 0
+wait_seconds_sum 0
+wait_seconds_count 0
+`)
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("up_total", "Up.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler()(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	assertOutput(t, rec.Body.String(), "# HELP up_total Up.\n# TYPE up_total counter\nup_total 1\n")
+}
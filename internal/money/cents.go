@@ -0,0 +1,156 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Valor monetário representado em centavos para evitar erros de arredondamento
+// de float64. Serializado em JSON como número decimal com 2 casas (ex: 19.90)
+type Cents int64
+
+var (
+	ErrInvalidAmount  = errors.New("invalid monetary amount")
+	ErrTooManyDecimal = errors.New("monetary amount has more than 2 decimal places")
+)
+
+func Parse(value string) (Cents, error) {
+	return parse(value, false)
+}
+
+// Como Parse, mas arredonda para o centavo mais próximo valores com mais de 2 casas decimais
+func Round(value string) (Cents, error) {
+	return parse(value, true)
+}
+
+// Maior expoente aceito na notação científica. Valores maiores já não cabem em Cents
+const maxExponent = 100
+
+func isDigits(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' }) < 0
+}
+
+// Converte a mantissa e o expoente para a notação decimal deslocando o ponto, sem
+// passar por float64, para a validação de casas decimais valer também nesse formato
+func shiftDecimal(mantissa, exponent string) (string, error) {
+	exp, err := strconv.Atoi(exponent)
+	if err != nil || exp < -maxExponent || exp > maxExponent {
+		return "", ErrInvalidAmount
+	}
+
+	integerPart, fractionPart, hasPoint := strings.Cut(mantissa, ".")
+	if !isDigits(integerPart) || (hasPoint && !isDigits(fractionPart)) {
+		return "", ErrInvalidAmount
+	}
+
+	digits := integerPart + fractionPart
+	point := len(integerPart) + exp
+
+	switch {
+	case point <= 0:
+		return "0." + strings.Repeat("0", -point) + digits, nil
+	case point >= len(digits):
+		return digits + strings.Repeat("0", point-len(digits)), nil
+	default:
+		return digits[:point] + "." + digits[point:], nil
+	}
+}
+
+func parse(value string, round bool) (Cents, error) {
+	if value == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	negative := false
+	if value[0] == '-' || value[0] == '+' {
+		negative = value[0] == '-'
+		value = value[1:]
+	}
+
+	// notação científica é válida em JSON mas não é usada pelos clientes
+	if i := strings.IndexAny(value, "eE"); i >= 0 {
+		expanded, err := shiftDecimal(value[:i], value[i+1:])
+		if err != nil {
+			return 0, err
+		}
+		value = expanded
+	}
+
+	integerPart, fractionPart, hasPoint := strings.Cut(value, ".")
+	if !isDigits(integerPart) || (hasPoint && !isDigits(fractionPart)) {
+		return 0, ErrInvalidAmount
+	}
+
+	// zeros à direita não alteram o valor (ex: 19.900)
+	fractionPart = strings.TrimRight(fractionPart, "0")
+	roundUp := false
+	if len(fractionPart) > 2 {
+		if !round {
+			return 0, ErrTooManyDecimal
+		}
+
+		// metade arredondada para longe do zero
+		roundUp = fractionPart[2] >= '5'
+		fractionPart = fractionPart[:2]
+	}
+	fractionPart += strings.Repeat("0", 2-len(fractionPart))
+
+	units, err := strconv.ParseInt(integerPart, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+
+	fraction, err := strconv.ParseInt(fractionPart, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+
+	if units > (math.MaxInt64-fraction)/100 {
+		return 0, ErrInvalidAmount
+	}
+
+	cents := units*100 + fraction
+	if roundUp {
+		if cents == math.MaxInt64 {
+			return 0, ErrInvalidAmount
+		}
+		cents++
+	}
+	if negative {
+		cents = -cents
+	}
+
+	return Cents(cents), nil
+}
+
+func (c Cents) String() string {
+	sign := ""
+	value := int64(c)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, value/100, value%100)
+}
+
+func (c Cents) MarshalJSON() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Cents) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	parsed, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+
+	*c = parsed
+	return nil
+}
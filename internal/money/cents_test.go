@@ -0,0 +1,114 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Cents
+		err   error
+	}{
+		{"19.90", 1990, nil},
+		{"19.9", 1990, nil},
+		{"19", 1900, nil},
+		{"19.900", 1990, nil},
+		{"0.01", 1, nil},
+		{"-19.90", -1990, nil},
+		{"+1.5", 150, nil},
+		{"1.234", 0, ErrTooManyDecimal},
+		{"-0.001", 0, ErrTooManyDecimal},
+
+		// notação científica
+		{"1.99e1", 1990, nil},
+		{"1E2", 10000, nil},
+		{"1e+2", 10000, nil},
+		{"199e-2", 199, nil},
+		{"-1.5e1", -1500, nil},
+		{"1e-2", 1, nil},
+		{"1.234e0", 0, ErrTooManyDecimal},
+		{"1e-3", 0, ErrTooManyDecimal},
+		{"1.2345e1", 0, ErrTooManyDecimal},
+		{"1e1000", 0, ErrInvalidAmount},
+		{"1e", 0, ErrInvalidAmount},
+		{"e2", 0, ErrInvalidAmount},
+		{"1.e2", 0, ErrInvalidAmount},
+
+		// overflow
+		{"92233720368547758.07", 9223372036854775807, nil},
+		{"92233720368547758.08", 0, ErrInvalidAmount},
+		{"1e17", 0, ErrInvalidAmount},
+
+		// formatos inválidos
+		{"", 0, ErrInvalidAmount},
+		{"-", 0, ErrInvalidAmount},
+		{".5", 0, ErrInvalidAmount},
+		{"1.", 0, ErrInvalidAmount},
+		{"--1", 0, ErrInvalidAmount},
+		{"1.-5", 0, ErrInvalidAmount},
+		{"1.2.3", 0, ErrInvalidAmount},
+		{"abc", 0, ErrInvalidAmount},
+		{"1_000", 0, ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Parse(%q) = (%d, %v), want (%d, %v)", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Cents
+		err   error
+	}{
+		{"19.90", 1990, nil},
+		{"19.905", 1991, nil},
+		{"19.904", 1990, nil},
+		{"0.999", 100, nil},
+		{"-1.2349", -123, nil},
+		{"-1.235", -124, nil},
+		{"1.234e0", 123, nil},
+		{"1.2355e1", 1236, nil},
+		{"5e-3", 1, nil},
+		{"4e-3", 0, nil},
+		{"92233720368547758.07", 9223372036854775807, nil},
+		{"92233720368547758.075", 0, ErrInvalidAmount},
+		{"1.23x", 0, ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		got, err := Round(tt.value)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Round(%q) = (%d, %v), want (%d, %v)", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var payload struct {
+		Amount Cents `json:"amount"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"amount":19.9}`), &payload); err != nil || payload.Amount != 1990 {
+		t.Fatalf("unexpected unmarshal result: (%d, %v)", payload.Amount, err)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil || string(data) != `{"amount":19.90}` {
+		t.Fatalf("unexpected marshal result: (%s, %v)", data, err)
+	}
+
+	for _, value := range []Cents{0, 5, -5, -1990} {
+		want := map[Cents]string{0: "0.00", 5: "0.05", -5: "-0.05", -1990: "-19.90"}[value]
+		if got := value.String(); got != want {
+			t.Errorf("Cents(%d).String() = %q, want %q", value, got, want)
+		}
+	}
+}
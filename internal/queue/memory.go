@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Fila em memória para rodar uma única instância (ex: desenvolvimento e testes).
+// O redis continua obrigatório para os demais componentes (dedup, dead letter queue e status)
+// Entradas reservadas e retries agendados são perdidos se o processo parar
+type MemoryQueue struct {
+	mu      sync.Mutex
+	items   [][]byte
+	retries map[*time.Timer]struct{} // retries agendados, descartados no purge
+	notify  chan struct{}
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		retries: make(map[*time.Timer]struct{}),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+func (q *MemoryQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, entry []byte) error {
+	q.mu.Lock()
+	q.items = append(q.items, entry)
+	q.mu.Unlock()
+
+	q.signal()
+	return nil
+}
+
+func (q *MemoryQueue) pushFront(entry []byte) {
+	q.mu.Lock()
+	q.items = append([][]byte{entry}, q.items...)
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+func (q *MemoryQueue) take(max int) [][]byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := min(max, len(q.items))
+	if n <= 0 {
+		return nil
+	}
+
+	batch := make([][]byte, n)
+	copy(batch, q.items[:n])
+	q.items = q.items[n:]
+
+	// ainda há entradas para outro consumidor
+	if len(q.items) > 0 {
+		q.signal()
+	}
+
+	return batch
+}
+
+func (q *MemoryQueue) DequeueBatch(ctx context.Context, max int, wait time.Duration) ([][]byte, error) {
+	if batch := q.take(max); batch != nil || wait <= 0 {
+		return batch, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			return nil, nil
+		case <-q.notify:
+			if batch := q.take(max); batch != nil {
+				return batch, nil
+			}
+		}
+	}
+}
+
+// Entradas reservadas só existem no consumidor, não há o que confirmar
+func (q *MemoryQueue) Ack(ctx context.Context, entry []byte) error {
+	return nil
+}
+
+func (q *MemoryQueue) Requeue(ctx context.Context, entry, next []byte, delay time.Duration) error {
+	if delay <= 0 {
+		q.pushFront(next)
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		_, scheduled := q.retries[timer]
+		delete(q.retries, timer)
+		if scheduled {
+			q.items = append(q.items, next)
+		}
+		q.mu.Unlock()
+
+		if scheduled {
+			q.signal()
+		}
+	})
+	q.retries[timer] = struct{}{}
+
+	return nil
+}
+
+// Descarta as entradas da fila e os retries agendados
+func (q *MemoryQueue) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items = nil
+	for timer := range q.retries {
+		timer.Stop()
+	}
+	clear(q.retries)
+}
+
+// A fila em memória não é apagada pelo script do /purge-payments, então é
+// descartada ao receber a notificação do purge
+func (q *MemoryQueue) ListenPurge(rc *redis.Client, channel string) {
+	sub := rc.Subscribe(context.Background(), channel)
+	defer sub.Close()
+
+	for range sub.Channel() {
+		q.Reset()
+		log.Println("In-memory work queue purged")
+	}
+}
+
+func (q *MemoryQueue) Depth(ctx context.Context) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return int64(len(q.items)), nil
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryQueueDequeueBatchKeepsOrder(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	for _, entry := range []string{"a", "b", "c"} {
+		q.Enqueue(ctx, []byte(entry))
+	}
+
+	batch, err := q.DequeueBatch(ctx, 2, 0)
+	if err != nil {
+		t.Fatalf("DequeueBatch: %v", err)
+	}
+
+	if len(batch) != 2 || string(batch[0]) != "a" || string(batch[1]) != "b" {
+		t.Fatalf("expected [a b], got %q", batch)
+	}
+
+	if depth, _ := q.Depth(ctx); depth != 1 {
+		t.Fatalf("expected depth 1, got %d", depth)
+	}
+}
+
+func TestMemoryQueueDequeueBatchTimeout(t *testing.T) {
+	q := NewMemoryQueue()
+
+	batch, err := q.DequeueBatch(context.Background(), 10, 20*time.Millisecond)
+	if err != nil || batch != nil {
+		t.Fatalf("expected (nil, nil) on timeout, got (%q, %v)", batch, err)
+	}
+}
+
+func TestMemoryQueueDequeueBatchWakesOnEnqueue(t *testing.T) {
+	q := NewMemoryQueue()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Enqueue(context.Background(), []byte("a"))
+	}()
+
+	batch, err := q.DequeueBatch(context.Background(), 10, time.Second)
+	if err != nil || len(batch) != 1 || string(batch[0]) != "a" {
+		t.Fatalf("expected [a], got (%q, %v)", batch, err)
+	}
+}
+
+func TestMemoryQueueDequeueBatchCanceled(t *testing.T) {
+	q := NewMemoryQueue()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := q.DequeueBatch(ctx, 10, time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMemoryQueueRequeue(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	q.Enqueue(ctx, []byte("a"))
+	q.Requeue(ctx, []byte("x"), []byte("b"), 0)
+	q.Requeue(ctx, []byte("y"), []byte("c"), 20*time.Millisecond)
+
+	// delay zero volta para o início da fila
+	batch, _ := q.DequeueBatch(ctx, 10, 0)
+	if len(batch) != 2 || string(batch[0]) != "b" || string(batch[1]) != "a" {
+		t.Fatalf("expected [b a], got %q", batch)
+	}
+
+	batch, _ = q.DequeueBatch(ctx, 10, time.Second)
+	if len(batch) != 1 || string(batch[0]) != "c" {
+		t.Fatalf("expected delayed [c], got %q", batch)
+	}
+}
+
+func TestMemoryQueueReset(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	q.Enqueue(ctx, []byte("a"))
+	q.Requeue(ctx, []byte("x"), []byte("b"), 20*time.Millisecond)
+	q.Reset()
+
+	if depth, _ := q.Depth(ctx); depth != 0 {
+		t.Fatalf("expected empty queue after reset, got depth %d", depth)
+	}
+
+	// o retry agendado antes do purge não volta para a fila
+	batch, _ := q.DequeueBatch(ctx, 10, 50*time.Millisecond)
+	if batch != nil {
+		t.Fatalf("expected no entries after reset, got %q", batch)
+	}
+
+	q.Enqueue(ctx, []byte("c"))
+	batch, _ = q.DequeueBatch(ctx, 10, 0)
+	if len(batch) != 1 || string(batch[0]) != "c" {
+		t.Fatalf("expected [c] after reset, got %q", batch)
+	}
+}
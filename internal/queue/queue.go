@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
+)
+
+// Fila de trabalho consumida pelo dispatcher. Entradas retiradas com DequeueBatch
+// ficam reservadas para a instância até serem confirmadas com Ack ou devolvidas com Requeue
+type Queue interface {
+	// Adiciona a entrada no fim da fila
+	Enqueue(ctx context.Context, entry []byte) error
+	// Reserva até max entradas. Com a fila vazia aguarda por até wait por uma entrada
+	DequeueBatch(ctx context.Context, max int, wait time.Duration) ([][]byte, error)
+	// Confirma o processamento de uma entrada reservada
+	Ack(ctx context.Context, entry []byte) error
+	// Libera a entrada reservada e enfileira next após delay. Com delay zero next volta
+	// para o início da fila
+	Requeue(ctx context.Context, entry, next []byte, delay time.Duration) error
+	// Qtd de entradas aguardando na fila
+	Depth(ctx context.Context) (int64, error)
+}
+
+// Implementado por filas no redis, que podem receber uma entrada de outra lista do redis
+// atomicamente, sem risco de perdê-la entre a remoção da origem e o enfileiramento
+type ListMover interface {
+	MoveFromList(ctx context.Context, source string, entry, next []byte) (bool, error)
+}
+
+// Exporta o tamanho da fila, consultado a cada coleta
+func RegisterMetrics(r *metrics.Registry, q Queue) {
+	r.NewGaugeFunc("payment_proxy_work_queue_depth", "Payments waiting in the work queue.", nil, func() []metrics.Sample {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		depth, err := q.Depth(ctx)
+		if err != nil {
+			return nil
+		}
+
+		return []metrics.Sample{{Value: float64(depth)}}
+	})
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ProcessingKeyPrefix = "work_queue:processing:"
+	heartbeatKeyPrefix  = "work_queue:heartbeat:"
+	instancesKey        = "work_queue:instances"
+)
+
+// Devolve para o início da fila tudo que estava na lista de processamento de uma
+// instância, preservando a ordem. Com ARGV[2] == '1' só recupera se a instância
+// não tiver mais heartbeat, garantindo que apenas um reaper recupere a lista
+const reclaimLuaScript = `
+local processingKey = KEYS[1]
+local workQueueKey = KEYS[2]
+local heartbeatKey = KEYS[3]
+local instancesKey = KEYS[4]
+local instanceID = ARGV[1]
+local checkHeartbeat = ARGV[2] == '1'
+
+if checkHeartbeat and redis.call('EXISTS', heartbeatKey) == 1 then
+	return -1
+end
+
+local moved = 0
+while redis.call('LMOVE', processingKey, workQueueKey, 'RIGHT', 'LEFT') do
+	moved = moved + 1
+end
+
+if checkHeartbeat then
+	redis.call('SREM', instancesKey, instanceID)
+end
+
+return moved
+`
+
+var reclaimScript = redis.NewScript(reclaimLuaScript)
+
+func (q *RedisQueue) reclaim(ctx context.Context, instanceID string, checkHeartbeat bool) (int64, error) {
+	check := "0"
+	if checkHeartbeat {
+		check = "1"
+	}
+
+	return reclaimScript.Run(ctx, q.redisClient,
+		[]string{
+			ProcessingKeyPrefix + instanceID,
+			q.key,
+			heartbeatKeyPrefix + instanceID,
+			instancesKey,
+		},
+		instanceID,
+		check,
+	).Int64()
+}
+
+// Mantém o heartbeat da instância enquanto o contexto não for cancelado
+func (q *RedisQueue) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(q.heartbeatTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		_, err := q.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, heartbeatKeyPrefix+q.instanceID, time.Now().UnixMilli(), q.heartbeatTTL)
+			pipe.SAdd(ctx, instancesKey, q.instanceID)
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to refresh instance heartbeat: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Recupera os works deixados nas listas de processamento de instâncias sem heartbeat
+func (q *RedisQueue) reaper(ctx context.Context) {
+	ticker := time.NewTicker(q.reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		instances, err := q.redisClient.SMembers(ctx, instancesKey).Result()
+		if err != nil {
+			log.Printf("Reaper failed to list instances: %v\n", err)
+			continue
+		}
+
+		for _, instanceID := range instances {
+			if instanceID == q.instanceID {
+				continue
+			}
+
+			moved, err := q.reclaim(ctx, instanceID, true)
+			if err != nil {
+				log.Printf("Reaper failed to reclaim work from %s: %v\n", instanceID, err)
+				continue
+			}
+
+			if moved >= 0 {
+				log.Printf("Reaper reclaimed %d works from dead instance %s\n", moved, instanceID)
+			}
+		}
+	}
+}
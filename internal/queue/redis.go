@@ -0,0 +1,196 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const WorkQueueKey = "work_queue"
+
+const dequeueBatchLuaScript = `
+local items = {}
+
+for i = 1, tonumber(ARGV[1]) do
+	local item = redis.call('LMOVE', KEYS[1], KEYS[2], 'LEFT', 'RIGHT')
+	if not item then
+		break
+	end
+	items[#items + 1] = item
+end
+
+return items
+`
+
+var dequeueBatchScript = redis.NewScript(dequeueBatchLuaScript)
+
+// Remove a entrada da lista de origem e enfileira o pagamento na mesma operação
+const moveFromListLuaScript = `
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+
+redis.call('RPUSH', KEYS[2], ARGV[2])
+return 1
+`
+
+var moveFromListScript = redis.NewScript(moveFromListLuaScript)
+
+// Fila em uma lista do redis. Entradas reservadas ficam na lista de processamento da
+// instância até serem confirmadas, e são devolvidas para a fila pelo reaper caso a
+// instância pare de responder
+type RedisQueue struct {
+	key            string
+	retryKey       string
+	instanceID     string
+	processingKey  string
+	heartbeatTTL   time.Duration
+	reaperInterval time.Duration
+	moverInterval  time.Duration
+	stop           context.CancelFunc
+	redisClient    *redis.Client
+}
+
+func NewRedisQueue(rc *redis.Client) *RedisQueue {
+	heartbeatTTL := utils.GetenvDuration("QUEUE_HEARTBEAT_TTL", "10s")
+	reaperInterval := utils.GetenvDuration("QUEUE_REAPER_INTERVAL", "5s")
+
+	// o heartbeat é renovado a cada terço do TTL, em milissegundos no redis
+	if heartbeatTTL < 3*time.Millisecond {
+		log.Printf("QUEUE_HEARTBEAT_TTL %v too short: using 10s\n", heartbeatTTL)
+		heartbeatTTL = 10 * time.Second
+	}
+	moverInterval := utils.GetenvDuration("RETRY_MOVER_INTERVAL", "100ms")
+
+	hostname, _ := os.Hostname()
+	instanceID := utils.Getenv("INSTANCE_ID", hostname)
+
+	return &RedisQueue{
+		key:            WorkQueueKey,
+		retryKey:       RetryQueueKey,
+		instanceID:     instanceID,
+		processingKey:  ProcessingKeyPrefix + instanceID,
+		heartbeatTTL:   heartbeatTTL,
+		reaperInterval: reaperInterval,
+		moverInterval:  moverInterval,
+		redisClient:    rc,
+	}
+}
+
+func (q *RedisQueue) Enqueue(ctx context.Context, entry []byte) error {
+	return q.redisClient.RPush(ctx, q.key, entry).Err()
+}
+
+// Move até max entradas para a lista de processamento em uma única ida ao redis.
+// Se a fila estiver vazia aguarda por uma entrada com BLMOVE
+func (q *RedisQueue) DequeueBatch(ctx context.Context, max int, wait time.Duration) ([][]byte, error) {
+	items, err := dequeueBatchScript.Run(ctx, q.redisClient,
+		[]string{q.key, q.processingKey},
+		max,
+	).StringSlice()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	if len(items) > 0 {
+		batch := make([][]byte, len(items))
+		for i, item := range items {
+			batch[i] = []byte(item)
+		}
+		return batch, nil
+	}
+
+	if wait <= 0 {
+		return nil, nil
+	}
+
+	res, err := q.redisClient.BLMove(ctx, q.key, q.processingKey, "LEFT", "RIGHT", wait).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]byte{[]byte(res)}, nil
+}
+
+func (q *RedisQueue) Ack(ctx context.Context, entry []byte) error {
+	return q.redisClient.LRem(ctx, q.processingKey, 1, entry).Err()
+}
+
+// Remove da lista de processamento e reenfileira na mesma transação
+func (q *RedisQueue) Requeue(ctx context.Context, entry, next []byte, delay time.Duration) error {
+	_, err := q.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, q.processingKey, 1, entry)
+		if delay > 0 {
+			q.schedulePipe(ctx, pipe, next, time.Now().Add(delay))
+		} else {
+			pipe.LPush(ctx, q.key, next)
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Move entry da lista source (ex: dead letter queue) para o fim da fila como next.
+// Retorna false se entry não estiver mais em source
+func (q *RedisQueue) MoveFromList(ctx context.Context, source string, entry, next []byte) (bool, error) {
+	moved, err := moveFromListScript.Run(ctx, q.redisClient, []string{source, q.key}, entry, next).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return moved == 1, nil
+}
+
+func (q *RedisQueue) Depth(ctx context.Context) (int64, error) {
+	return q.redisClient.LLen(ctx, q.key).Result()
+}
+
+// Recupera a lista de processamento de uma execução anterior da instância e inicia o
+// heartbeat, o reaper e a promoção dos retries agendados
+func (q *RedisQueue) Start(ctx context.Context) {
+	ctx, q.stop = context.WithCancel(ctx)
+
+	moved, err := q.reclaim(ctx, q.instanceID, false)
+	if err != nil {
+		log.Printf("Failed to recover processing list: %v\n", err)
+	} else if moved > 0 {
+		log.Printf("Recovered %d works left in processing by a previous run\n", moved)
+	}
+
+	go q.heartbeat(ctx)
+	go q.reaper(ctx)
+	go q.startMover(ctx)
+}
+
+// Para as rotinas em background e devolve para o início da fila tudo que ainda estiver
+// na lista de processamento da instância (ex: works que não terminaram até o shutdown)
+func (q *RedisQueue) Close(ctx context.Context) error {
+	if q.stop != nil {
+		q.stop()
+	}
+
+	moved, err := q.reclaim(ctx, q.instanceID, false)
+	if err != nil {
+		return err
+	}
+
+	if moved > 0 {
+		log.Printf("Returned %d works left in processing to work_queue\n", moved)
+	}
+
+	_, err = q.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, heartbeatKeyPrefix+q.instanceID)
+		pipe.SRem(ctx, instancesKey, q.instanceID)
+		return nil
+	})
+
+	return err
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const RetryQueueKey = "work_queue:retry"
+
+// Move para o fim da fila de trabalho as entradas cujo horário de retry já passou
+const promoteRetriesLuaScript = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+
+for _, entry in ipairs(due) do
+	redis.call('RPUSH', KEYS[2], entry)
+end
+
+if #due > 0 then
+	redis.call('ZREM', KEYS[1], unpack(due))
+end
+
+return #due
+`
+
+var promoteRetriesScript = redis.NewScript(promoteRetriesLuaScript)
+
+// Quantidade máxima de entradas promovidas por execução do script
+const retryPromoteBatchSize = 500
+
+// Agenda a entrada dentro de um pipeline, com score igual ao horário da próxima tentativa
+func (q *RedisQueue) schedulePipe(ctx context.Context, pipe redis.Pipeliner, entry []byte, at time.Time) {
+	pipe.ZAdd(ctx, q.retryKey, redis.Z{
+		Score:  float64(at.UnixMilli()),
+		Member: entry,
+	})
+}
+
+// Qtd de retries agendados aguardando o horário da próxima tentativa
+func (q *RedisQueue) PendingRetries(ctx context.Context) (int64, error) {
+	return q.redisClient.ZCard(ctx, q.retryKey).Result()
+}
+
+func (q *RedisQueue) promoteDue(ctx context.Context) (int64, error) {
+	return promoteRetriesScript.Run(ctx, q.redisClient,
+		[]string{q.retryKey, q.key},
+		time.Now().UnixMilli(),
+		retryPromoteBatchSize,
+	).Int64()
+}
+
+// Promove periodicamente os retries vencidos até o contexto ser cancelado
+func (q *RedisQueue) startMover(ctx context.Context) {
+	ticker := time.NewTicker(q.moverInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			promoted, err := q.promoteDue(ctx)
+			if err != nil {
+				log.Printf("Failed to promote scheduled retries: %v\n", err)
+				break
+			}
+
+			// lote cheio: ainda pode haver retries vencidos
+			if promoted < retryPromoteBatchSize {
+				break
+			}
+		}
+	}
+}
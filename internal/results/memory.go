@@ -0,0 +1,123 @@
+package results
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/money"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+type memoryBucket struct {
+	timestamp int64
+	totals    ProcessorTotals
+}
+
+// Resultados em memória com resolução de ms, para testes e para rodar uma única instância.
+// Os buckets de cada host ficam ordenados por timestamp
+type MemoryStore struct {
+	sync.RWMutex
+	buckets   map[string][]memoryBucket
+	retention time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	retention := utils.GetenvDuration("RESULTS_RETENTION", "720h")
+
+	return &MemoryStore{
+		buckets:   make(map[string][]memoryBucket),
+		retention: retention,
+	}
+}
+
+// Descarta todos os resultados
+func (ms *MemoryStore) Reset() {
+	ms.Lock()
+	defer ms.Unlock()
+
+	ms.buckets = make(map[string][]memoryBucket)
+}
+
+// Os resultados em memória não são apagados pelo script do /purge-payments,
+// então são descartados ao receber a notificação do purge
+func (ms *MemoryStore) ListenPurge(rc *redis.Client, channel string) {
+	sub := rc.Subscribe(context.Background(), channel)
+	defer sub.Close()
+
+	for range sub.Channel() {
+		ms.Reset()
+		log.Println("In-memory results purged")
+	}
+}
+
+func (ms *MemoryStore) Record(ctx context.Context, host string, timestamp int64, amount money.Cents) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	buckets := ms.buckets[host]
+
+	// os resultados chegam quase sempre em ordem, então a busca normalmente termina no fim
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].timestamp >= timestamp })
+	if i < len(buckets) && buckets[i].timestamp == timestamp {
+		buckets[i].totals.Count++
+		buckets[i].totals.Amount += amount
+		return nil
+	}
+
+	buckets = append(buckets, memoryBucket{})
+	copy(buckets[i+1:], buckets[i:])
+	buckets[i] = memoryBucket{
+		timestamp: timestamp,
+		totals:    ProcessorTotals{Count: 1, Amount: amount},
+	}
+
+	if ms.retention > 0 {
+		cutoff := timestamp - ms.retention.Milliseconds()
+		expired := sort.Search(len(buckets), func(i int) bool { return buckets[i].timestamp >= cutoff })
+		buckets = buckets[expired:]
+	}
+
+	ms.buckets[host] = buckets
+	return nil
+}
+
+func (ms *MemoryStore) sumRange(host string, from, to int64) ProcessorTotals {
+	buckets := ms.buckets[host]
+
+	var totals ProcessorTotals
+	i := sort.Search(len(buckets), func(i int) bool { return buckets[i].timestamp >= from })
+	for ; i < len(buckets) && buckets[i].timestamp <= to; i++ {
+		totals.Count += buckets[i].totals.Count
+		totals.Amount += buckets[i].totals.Amount
+	}
+
+	return totals
+}
+
+func (ms *MemoryStore) Totals(ctx context.Context, start, end int64) (*RangeTotals, error) {
+	return totals(ctx, ms, start, end)
+}
+
+func (ms *MemoryStore) Series(ctx context.Context, start, end, step int64) ([]SeriesPoint, error) {
+	if end == 0 {
+		end = maxTimestamp
+	}
+
+	points := newSeriesPoints(start, end, step)
+
+	ms.RLock()
+	defer ms.RUnlock()
+
+	for i := range points {
+		from, to := points[i].bounds(start, end, step)
+		points[i].Default = ms.sumRange(http.DefaultHost, from, to)
+		points[i].Fallback = ms.sumRange(http.FallbackHost, from, to)
+	}
+
+	return points, nil
+}
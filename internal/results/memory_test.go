@@ -0,0 +1,82 @@
+package results
+
+import (
+	"context"
+	"testing"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+)
+
+func TestMemoryStoreTotals(t *testing.T) {
+	ms := NewMemoryStore()
+	ctx := context.Background()
+
+	ms.Record(ctx, http.DefaultHost, 1000, 1990)
+	ms.Record(ctx, http.DefaultHost, 1000, 10)
+	ms.Record(ctx, http.DefaultHost, 3000, 500)
+	// fora de ordem
+	ms.Record(ctx, http.FallbackHost, 2000, 100)
+	ms.Record(ctx, http.FallbackHost, 1500, 100)
+
+	totals, err := ms.Totals(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("Totals: %v", err)
+	}
+	if totals.Default != (ProcessorTotals{Count: 3, Amount: 2500}) {
+		t.Fatalf("unexpected default totals: %+v", totals.Default)
+	}
+	if totals.Fallback != (ProcessorTotals{Count: 2, Amount: 200}) {
+		t.Fatalf("unexpected fallback totals: %+v", totals.Fallback)
+	}
+
+	totals, _ = ms.Totals(ctx, 1000, 2000)
+	if totals.Default != (ProcessorTotals{Count: 2, Amount: 2000}) {
+		t.Fatalf("unexpected default totals in [1000, 2000]: %+v", totals.Default)
+	}
+	if totals.Fallback != (ProcessorTotals{Count: 2, Amount: 200}) {
+		t.Fatalf("unexpected fallback totals in [1000, 2000]: %+v", totals.Fallback)
+	}
+}
+
+func TestMemoryStoreSeries(t *testing.T) {
+	ms := NewMemoryStore()
+	ctx := context.Background()
+
+	ms.Record(ctx, http.DefaultHost, 1000, 100)
+	ms.Record(ctx, http.DefaultHost, 1999, 100)
+	ms.Record(ctx, http.DefaultHost, 2500, 100)
+
+	points, err := ms.Series(ctx, 1500, 2999, 1000)
+	if err != nil {
+		t.Fatalf("Series: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(points))
+	}
+	// o primeiro ponto é recortado pelo start
+	if points[0].Start != 1000 || points[0].Default.Count != 1 {
+		t.Fatalf("unexpected first point: %+v", points[0])
+	}
+	if points[1].Start != 2000 || points[1].Default.Count != 1 {
+		t.Fatalf("unexpected second point: %+v", points[1])
+	}
+}
+
+func TestMemoryStoreReset(t *testing.T) {
+	ms := NewMemoryStore()
+	ctx := context.Background()
+
+	ms.Record(ctx, http.DefaultHost, 1000, 100)
+	ms.Reset()
+
+	totals, _ := ms.Totals(ctx, 0, 0)
+	if totals.Default.Count != 0 || totals.Fallback.Count != 0 {
+		t.Fatalf("expected empty totals after reset, got %+v", totals)
+	}
+
+	ms.Record(ctx, http.FallbackHost, 2000, 100)
+	totals, _ = ms.Totals(ctx, 0, 0)
+	if totals.Fallback.Count != 1 {
+		t.Fatalf("expected records after reset, got %+v", totals)
+	}
+}
@@ -0,0 +1,370 @@
+package results
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/money"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// Prefixo de todas as chaves de resultados: results:<host>:<nível>[:<bucket pai>]
+const KeyPrefix = "results:"
+
+// Os resultados são agregados em 4 níveis (hora, minuto, segundo e milissegundo).
+// Cada nível é um hash cujos campos são "<bucket>:c" (contagem) e "<bucket>:a" (centavos).
+// O nível de hora fica em um único hash (results:<host>:h) e os demais ficam em um hash
+// por bucket do nível acima (ex: results:<host>:s:<minuto> guarda os segundos daquele minuto).
+// Os hashes de cada nível são indexados em results:<host>:idx:<nível> pelo timestamp inicial
+// para que a compactação encontre os mais antigos sem varrer o keyspace
+const resultsLevelsLua = `
+local levels = {
+	{ name = 'h', size = 3600000 },
+	{ name = 'm', size = 60000 },
+	{ name = 's', size = 1000 },
+	{ name = 'ms', size = 1 },
+}
+
+local function levelKey(prefix, level, parentIdx)
+	if level == 1 then
+		return prefix .. ':' .. levels[1].name
+	end
+	return prefix .. ':' .. levels[level].name .. ':' .. string.format('%d', parentIdx)
+end
+
+local function indexKey(prefix, level)
+	return prefix .. ':idx:' .. levels[level].name
+end
+`
+
+const updateResultsLuaScript = resultsLevelsLua + `
+local prefix = KEYS[1]
+local timestamp = tonumber(ARGV[1])
+local amountValue = ARGV[2] -- centavos
+local incrementVal = ARGV[3]
+
+local parentIdx = 0
+for level = 1, #levels do
+	local idx = math.floor(timestamp / levels[level].size)
+	local key = levelKey(prefix, level, parentIdx)
+	local field = string.format('%d', idx)
+
+	local newCount = redis.call('HINCRBY', key, field .. ':c', incrementVal)
+	redis.call('HINCRBY', key, field .. ':a', amountValue)
+
+	-- primeiro registro do bucket: o hash do nível abaixo acabou de ser criado
+	if newCount == tonumber(incrementVal) and level < #levels then
+		redis.call('ZADD', indexKey(prefix, level + 1), 'NX', idx * levels[level].size, levelKey(prefix, level + 1, idx))
+	end
+
+	parentIdx = idx
+end
+
+return 1
+`
+
+// Soma [from, to] decompondo a janela: buckets completos são lidos no nível mais
+// grosso possível e apenas as bordas descem para os níveis mais finos. Cada consulta
+// lê no máximo 2 hashes por nível, independente do tamanho da janela
+const resultsRangeLuaScript = resultsLevelsLua + `
+local prefix = KEYS[1]
+local from = tonumber(ARGV[1])
+local to = tonumber(ARGV[2])
+
+-- indexado pela string do bucket para não criar tabelas esparsas com índices numéricos enormes
+local function readBuckets(key)
+	local buckets = {}
+	local data = redis.call('HGETALL', key)
+	for i = 1, #data, 2 do
+		local idx, kind = string.match(data[i], '^(%d+):(%a)$')
+		if idx then
+			local bucket = buckets[idx]
+			if not bucket then
+				bucket = { idx = tonumber(idx), c = 0, a = 0 }
+				buckets[idx] = bucket
+			end
+			bucket[kind] = tonumber(data[i + 1])
+		end
+	end
+	return buckets
+end
+
+local function sumRange(level, key, from, to)
+	local size = levels[level].size
+	local first = math.floor(from / size)
+	local last = math.floor(to / size)
+	local buckets = readBuckets(key)
+	local count, amount = 0, 0
+
+	for _, bucket in pairs(buckets) do
+		if bucket.idx > first and bucket.idx < last then
+			count = count + bucket.c
+			amount = amount + bucket.a
+		end
+	end
+
+	local edges = { first }
+	if last ~= first then
+		edges[2] = last
+	end
+
+	for _, idx in ipairs(edges) do
+		local bucket = buckets[string.format('%d', idx)]
+		if bucket then
+			local bucketStart = idx * size
+			local bucketEnd = bucketStart + size - 1
+			local lo = math.max(from, bucketStart)
+			local hi = math.min(to, bucketEnd)
+
+			if lo == bucketStart and hi == bucketEnd then
+				count = count + bucket.c
+				amount = amount + bucket.a
+			else
+				local childKey = levelKey(prefix, level + 1, idx)
+				if redis.call('EXISTS', childKey) == 1 then
+					local c, a = sumRange(level + 1, childKey, lo, hi)
+					count = count + c
+					amount = amount + a
+				elseif bucketStart >= from then
+					-- nível mais fino não existe mais: o bucket é contado pelo seu início
+					count = count + bucket.c
+					amount = amount + bucket.a
+				end
+			end
+		end
+	end
+
+	return count, amount
+end
+
+local count, amount = sumRange(1, levelKey(prefix, 1, 0), from, to)
+
+return {count, amount}
+`
+
+// Remove os hashes de minuto, segundo e milissegundo que terminam antes do corte de cada
+// nível e os campos do hash de horas fora da retenção. Buckets compactados continuam
+// disponíveis nos níveis mais grossos
+const compactResultsLuaScript = resultsLevelsLua + `
+local prefix = KEYS[1]
+local limit = tonumber(ARGV[#ARGV])
+local removed = 0
+
+local hourCutoff = tonumber(ARGV[1])
+local hourKey = levelKey(prefix, 1, 0)
+local fields = redis.call('HKEYS', hourKey)
+for _, field in ipairs(fields) do
+	local idx = tonumber(string.match(field, '^(%d+):'))
+	if idx and (idx + 1) * levels[1].size <= hourCutoff then
+		removed = removed + redis.call('HDEL', hourKey, field)
+	end
+end
+
+for level = 2, #levels do
+	local cutoff = tonumber(ARGV[level])
+	local parentSize = levels[level - 1].size
+	local index = indexKey(prefix, level)
+	local keys = redis.call('ZRANGEBYSCORE', index, '-inf', cutoff - parentSize, 'LIMIT', 0, limit)
+
+	for _, key in ipairs(keys) do
+		removed = removed + redis.call('UNLINK', key)
+	end
+
+	if #keys > 0 then
+		redis.call('ZREM', index, unpack(keys))
+	end
+end
+
+return removed
+`
+
+// Quantidade máxima de hashes removidos por nível em cada execução da compactação
+const compactionBatchSize = 1000
+
+// Resultados agregados em hashes no redis, compartilhados entre as instâncias
+type RedisStore struct {
+	updateScript       *redis.Script
+	rangeScript        *redis.Script
+	compactScript      *redis.Script
+	retention          time.Duration
+	minuteRetention    time.Duration
+	secondRetention    time.Duration
+	msRetention        time.Duration
+	compactionInterval time.Duration
+	redisClient        *redis.Client
+}
+
+func NewRedisStore(rc *redis.Client) *RedisStore {
+	retention := utils.GetenvDuration("RESULTS_RETENTION", "720h")
+	minuteRetention := utils.GetenvDuration("RESULTS_MINUTE_RETENTION", "168h")
+	secondRetention := utils.GetenvDuration("RESULTS_SECOND_RETENTION", "6h")
+	msRetention := utils.GetenvDuration("RESULTS_MS_RETENTION", "15m")
+	compactionInterval := utils.GetenvDuration("RESULTS_COMPACTION_INTERVAL", "1m")
+
+	// um nível mais fino nunca é mantido por mais tempo que os níveis acima dele
+	minuteRetention = min(minuteRetention, retention)
+	secondRetention = min(secondRetention, minuteRetention)
+	msRetention = min(msRetention, secondRetention)
+
+	return &RedisStore{
+		updateScript:       redis.NewScript(updateResultsLuaScript),
+		rangeScript:        redis.NewScript(resultsRangeLuaScript),
+		compactScript:      redis.NewScript(compactResultsLuaScript),
+		retention:          retention,
+		minuteRetention:    minuteRetention,
+		secondRetention:    secondRetention,
+		msRetention:        msRetention,
+		compactionInterval: compactionInterval,
+		redisClient:        rc,
+	}
+}
+
+func resultsKey(host string) string {
+	return KeyPrefix + host
+}
+
+func (rs *RedisStore) Record(ctx context.Context, host string, timestamp int64, amount money.Cents) error {
+	return rs.updateScript.Run(ctx, rs.redisClient,
+		[]string{resultsKey(host)},
+		timestamp,
+		int64(amount),
+		1, // incrementa 1 no contador
+	).Err()
+}
+
+func (rs *RedisStore) Totals(ctx context.Context, start, end int64) (*RangeTotals, error) {
+	return totals(ctx, rs, start, end)
+}
+
+func (rs *RedisStore) Series(ctx context.Context, start, end, step int64) ([]SeriesPoint, error) {
+	if end == 0 {
+		end = maxTimestamp
+	}
+
+	points := newSeriesPoints(start, end, step)
+
+	cmds, err := rs.execRangePipeline(ctx, points, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range points {
+		if points[i].Default, err = parseTotalsCmd(cmds[2*i]); err != nil {
+			return nil, err
+		}
+		if points[i].Fallback, err = parseTotalsCmd(cmds[2*i+1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return points, nil
+}
+
+func (rs *RedisStore) execRangePipeline(ctx context.Context, points []SeriesPoint, start, end, step int64) ([]*redis.Cmd, error) {
+	var cmds []*redis.Cmd
+
+	exec := func() error {
+		cmds = make([]*redis.Cmd, 0, 2*len(points))
+		pipe := rs.redisClient.Pipeline()
+
+		for _, point := range points {
+			from, to := point.bounds(start, end, step)
+
+			for _, host := range []string{http.DefaultHost, http.FallbackHost} {
+				cmds = append(cmds, rs.rangeScript.EvalSha(ctx, pipe, []string{resultsKey(host)}, from, to))
+			}
+		}
+
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+
+	err := exec()
+	if err != nil && redis.HasErrorPrefix(err, "NOSCRIPT") {
+		if err = rs.rangeScript.Load(ctx, rs.redisClient).Err(); err != nil {
+			return nil, err
+		}
+
+		err = exec()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cmds, nil
+}
+
+// Executa a compactação periodicamente até o contexto ser cancelado.
+// Todas as instâncias podem executá-la: remover um bucket já removido não tem efeito
+func (rs *RedisStore) StartCompaction(ctx context.Context) {
+	if rs.compactionInterval <= 0 {
+		log.Println("Results compaction disabled")
+		return
+	}
+
+	ticker := time.NewTicker(rs.compactionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := rs.Compact(ctx, time.Now())
+			if err != nil {
+				log.Printf("Failed to compact results: %v\n", err)
+				continue
+			}
+
+			if removed > 0 {
+				log.Printf("Results compaction removed %d buckets\n", removed)
+			}
+		}
+	}
+}
+
+func (rs *RedisStore) Compact(ctx context.Context, now time.Time) (int64, error) {
+	cutoff := func(retention time.Duration) int64 {
+		return now.Add(-retention).UnixMilli()
+	}
+
+	removed := int64(0)
+	for _, host := range []string{http.DefaultHost, http.FallbackHost} {
+		n, err := rs.compactScript.Run(ctx, rs.redisClient,
+			[]string{resultsKey(host)},
+			cutoff(rs.retention),
+			cutoff(rs.minuteRetention),
+			cutoff(rs.secondRetention),
+			cutoff(rs.msRetention),
+			compactionBatchSize,
+		).Int64()
+		if err != nil {
+			return removed, err
+		}
+
+		removed += n
+	}
+
+	return removed, nil
+}
+
+func parseTotalsCmd(cmd *redis.Cmd) (ProcessorTotals, error) {
+	values, err := cmd.Int64Slice()
+	if err != nil {
+		return ProcessorTotals{}, err
+	}
+
+	if len(values) != 2 {
+		return ProcessorTotals{}, fmt.Errorf("unexpected results range reply: %v", values)
+	}
+
+	return ProcessorTotals{
+		Count:  values[0],
+		Amount: money.Cents(values[1]),
+	}, nil
+}
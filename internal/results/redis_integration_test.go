@@ -0,0 +1,189 @@
+//go:build integration
+
+package results
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/money"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// Executados contra um redis real:
+// REDIS_ADDR=localhost:6379 go test -tags integration ./internal/results/
+// O banco testRedisDB é apagado no início de cada teste
+const testRedisDB = 15
+
+func newTestRedisStore(t *testing.T) *RedisStore {
+	t.Helper()
+
+	t.Setenv("RESULTS_RETENTION", "720h")
+	t.Setenv("RESULTS_MINUTE_RETENTION", "168h")
+	t.Setenv("RESULTS_SECOND_RETENTION", "6h")
+	t.Setenv("RESULTS_MS_RETENTION", "1m")
+
+	rc := redis.NewClient(&redis.Options{
+		Addr: utils.Getenv("REDIS_ADDR", "localhost:6379"),
+		DB:   testRedisDB,
+	})
+	t.Cleanup(func() { rc.Close() })
+
+	ctx := context.Background()
+	if err := rc.Ping(ctx).Err(); err != nil {
+		t.Fatalf("redis not available: %v", err)
+	}
+	if err := rc.FlushDB(ctx).Err(); err != nil {
+		t.Fatalf("FlushDB: %v", err)
+	}
+
+	return NewRedisStore(rc)
+}
+
+// início de uma hora, em ms
+var testHour = time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC).UnixMilli()
+
+const (
+	testMinute = int64(60_000)
+	testSecond = int64(1_000)
+)
+
+type testRecord struct {
+	host      string
+	timestamp int64
+	amount    money.Cents
+}
+
+func record(t *testing.T, rs *RedisStore, records []testRecord) {
+	t.Helper()
+
+	for _, r := range records {
+		if err := rs.Record(context.Background(), r.host, r.timestamp, r.amount); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+}
+
+func assertTotals(t *testing.T, rs *RedisStore, start, end int64, want RangeTotals) {
+	t.Helper()
+
+	got, err := rs.Totals(context.Background(), start, end)
+	if err != nil {
+		t.Fatalf("Totals(%d, %d): %v", start, end, err)
+	}
+
+	if *got != want {
+		t.Fatalf("Totals(%d, %d) = %+v, want %+v", start, end, *got, want)
+	}
+}
+
+func TestRedisStoreRange(t *testing.T) {
+	rs := newTestRedisStore(t)
+
+	second := testHour + 10*testMinute + 5*testSecond
+	record(t, rs, []testRecord{
+		{http.DefaultHost, second + 123, 100},
+		{http.DefaultHost, second + 900, 200},
+		{http.DefaultHost, testHour + 10*testMinute + 30*testSecond, 300},
+		{http.DefaultHost, testHour + 45*testMinute, 400},
+		{http.FallbackHost, testHour + 59*testMinute + 59*testSecond + 999, 500},
+		{http.FallbackHost, testHour + 60*testMinute, 600},
+	})
+
+	// intervalo aberto
+	assertTotals(t, rs, 0, 0, RangeTotals{
+		Default:  ProcessorTotals{Count: 4, Amount: 1000},
+		Fallback: ProcessorTotals{Count: 2, Amount: 1100},
+	})
+
+	// dentro de um segundo: desce até os milissegundos
+	assertTotals(t, rs, second+123, second+899, RangeTotals{
+		Default: ProcessorTotals{Count: 1, Amount: 100},
+	})
+
+	// bordas parciais em níveis diferentes
+	assertTotals(t, rs, second+124, testHour+59*testMinute+59*testSecond+999, RangeTotals{
+		Default:  ProcessorTotals{Count: 3, Amount: 900},
+		Fallback: ProcessorTotals{Count: 1, Amount: 500},
+	})
+
+	// limites inclusivos na virada da hora
+	assertTotals(t, rs, testHour+60*testMinute, testHour+60*testMinute, RangeTotals{
+		Fallback: ProcessorTotals{Count: 1, Amount: 600},
+	})
+}
+
+func TestRedisStoreRangeAcrossCompactedBuckets(t *testing.T) {
+	rs := newTestRedisStore(t)
+	ctx := context.Background()
+
+	now := time.UnixMilli(testHour + 2*60*testMinute)
+	oldSecond := testHour + 10*testMinute + 5*testSecond
+	recentSecond := now.UnixMilli() - 10*testSecond
+
+	record(t, rs, []testRecord{
+		{http.DefaultHost, oldSecond + 123, 100},
+		{http.DefaultHost, oldSecond + 900, 200},
+		{http.DefaultHost, recentSecond + 250, 300},
+		{http.DefaultHost, recentSecond + 750, 400},
+	})
+
+	removed, err := rs.Compact(ctx, now)
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	// somente o hash de milissegundos do segundo antigo passou da retenção
+	if removed != 1 {
+		t.Fatalf("expected 1 compacted bucket, got %d", removed)
+	}
+
+	// o segundo compactado é lido inteiro e o recente desce até os milissegundos
+	assertTotals(t, rs, oldSecond, recentSecond+500, RangeTotals{
+		Default: ProcessorTotals{Count: 3, Amount: 600},
+	})
+
+	// sem os milissegundos, o segundo compactado é contado pelo seu início
+	assertTotals(t, rs, oldSecond, oldSecond+500, RangeTotals{
+		Default: ProcessorTotals{Count: 2, Amount: 300},
+	})
+	assertTotals(t, rs, oldSecond+1, recentSecond+500, RangeTotals{
+		Default: ProcessorTotals{Count: 1, Amount: 300},
+	})
+
+	// os totais do período inteiro não mudam com a compactação
+	assertTotals(t, rs, 0, 0, RangeTotals{
+		Default: ProcessorTotals{Count: 4, Amount: 1000},
+	})
+
+	points, err := rs.Series(ctx, testHour, now.UnixMilli()-1, 60*testMinute)
+	if err != nil {
+		t.Fatalf("Series: %v", err)
+	}
+	if len(points) != 2 || points[0].Default.Count != 2 || points[1].Default.Count != 2 {
+		t.Fatalf("unexpected series: %+v", points)
+	}
+}
+
+func TestRedisStoreCompactionRetention(t *testing.T) {
+	rs := newTestRedisStore(t)
+	ctx := context.Background()
+
+	now := time.UnixMilli(testHour)
+	expired := now.Add(-721 * time.Hour).UnixMilli()
+
+	record(t, rs, []testRecord{
+		{http.DefaultHost, expired, 100},
+		{http.DefaultHost, testHour - testSecond, 200},
+	})
+
+	if _, err := rs.Compact(ctx, now); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	assertTotals(t, rs, 0, 0, RangeTotals{
+		Default: ProcessorTotals{Count: 1, Amount: 200},
+	})
+}
@@ -0,0 +1,67 @@
+package results
+
+import (
+	"context"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/money"
+)
+
+// Maior timestamp representável sem perda de precisão nos scripts lua
+const maxTimestamp = 1<<53 - 1
+
+// Armazena os pagamentos processados por cada processor. Timestamps em ms
+type Store interface {
+	// Registra um pagamento processado pelo host no timestamp
+	Record(ctx context.Context, host string, timestamp int64, amount money.Cents) error
+	// Totais de cada processor no intervalo [start, end]. Zero indica intervalo aberto
+	Totals(ctx context.Context, start, end int64) (*RangeTotals, error)
+	// Totais agrupados em intervalos de step ms alinhados ao epoch. O primeiro e o
+	// último intervalo são recortados por start e end. Step zero retorna um único ponto
+	Series(ctx context.Context, start, end, step int64) ([]SeriesPoint, error)
+}
+
+type ProcessorTotals struct {
+	Count  int64
+	Amount money.Cents
+}
+
+type RangeTotals struct {
+	Default  ProcessorTotals
+	Fallback ProcessorTotals
+}
+
+type SeriesPoint struct {
+	Start int64
+	RangeTotals
+}
+
+func newSeriesPoints(start, end, step int64) []SeriesPoint {
+	points := []SeriesPoint{}
+	if step <= 0 {
+		return append(points, SeriesPoint{Start: start})
+	}
+
+	for bucket := start - start%step; bucket <= end; bucket += step {
+		points = append(points, SeriesPoint{Start: bucket})
+	}
+
+	return points
+}
+
+// Intervalo [from, to] coberto pelo ponto, recortado por start e end
+func (p SeriesPoint) bounds(start, end, step int64) (from, to int64) {
+	if step <= 0 {
+		return start, end
+	}
+
+	return max(p.Start, start), min(p.Start+step-1, end)
+}
+
+func totals(ctx context.Context, s Store, start, end int64) (*RangeTotals, error) {
+	points, err := s.Series(ctx, start, end, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &points[0].RangeTotals, nil
+}
@@ -0,0 +1,129 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/balancer"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/breaker"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+)
+
+type Class string
+
+const (
+	ClassTimeout     Class = "timeout"      // processor não respondeu a tempo
+	ClassServerError Class = "server_error" // processor respondeu com 5xx
+	ClassUnavailable Class = "unavailable"  // nenhum processor disponível (circuitos abertos)
+	ClassOther       Class = "other"
+)
+
+type Policy struct {
+	Base   time.Duration
+	Max    time.Duration
+	Jitter float64 // fração do delay sorteada para mais ou para menos (0.2 = ±20%)
+}
+
+// Backoff exponencial: base * 2^(attempt-1), limitado a Max, com jitter
+func (p Policy) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := float64(p.Base) * math.Pow(2, float64(attempt-1))
+	delay = math.Min(delay, float64(p.Max))
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(max(delay, 0))
+}
+
+type Backoff struct {
+	policies map[Class]Policy
+}
+
+var defaultPolicies = map[Class]string{
+	ClassTimeout:     "200ms,10s,0.2",
+	ClassServerError: "100ms,5s,0.2",
+	ClassUnavailable: "500ms,15s,0.3",
+	ClassOther:       "100ms,5s,0.2",
+}
+
+// Lê as políticas de RETRY_BACKOFF_<CLASSE> no formato "base,max,jitter"
+func NewBackoff() *Backoff {
+	policies := make(map[Class]Policy, len(defaultPolicies))
+
+	for class, fallback := range defaultPolicies {
+		envKey := "RETRY_BACKOFF_" + strings.ToUpper(string(class))
+
+		policy, err := parsePolicy(utils.Getenv(envKey, fallback))
+		if err != nil {
+			log.Printf("Invalid %s: %v. Using fallback value: %s\n", envKey, err, fallback)
+			policy, _ = parsePolicy(fallback)
+		}
+
+		policies[class] = policy
+	}
+
+	return &Backoff{policies: policies}
+}
+
+func parsePolicy(value string) (Policy, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return Policy{}, errors.New("expected base,max,jitter")
+	}
+
+	base, err := time.ParseDuration(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Policy{}, err
+	}
+
+	maxDelay, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return Policy{}, err
+	}
+
+	jitter, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	return Policy{
+		Base:   base,
+		Max:    max(base, maxDelay),
+		Jitter: min(max(jitter, 0), 1),
+	}, nil
+}
+
+// Somente a indisponibilidade pura (nenhuma réplica executou a requisição) é
+// classificada como ClassUnavailable. Se alguma réplica executou, o erro dela
+// decide a classe, mesmo que a outra réplica esteja indisponível
+func Classify(err error) Class {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+	case errors.Is(err, http.ErrInternalServerError):
+		return ClassServerError
+	case errors.Is(err, balancer.ErrReplicaFailed):
+		return ClassOther
+	case errors.Is(err, balancer.ErrAllReplicasFailed), errors.Is(err, breaker.ErrCircuitOpen),
+		errors.Is(err, balancer.ErrBulkheadFull):
+		return ClassUnavailable
+	default:
+		return ClassOther
+	}
+}
+
+func (b *Backoff) Delay(err error, attempt int) time.Duration {
+	return b.policies[Classify(err)].Delay(attempt)
+}
@@ -0,0 +1,77 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/balancer"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/breaker"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Class
+	}{
+		{"timeout", context.DeadlineExceeded, ClassTimeout},
+		{"server error", http.ErrInternalServerError, ClassServerError},
+		{"circuit open", breaker.ErrCircuitOpen, ClassUnavailable},
+		{"bulkhead full", balancer.ErrBulkheadFull, ClassUnavailable},
+		{"no replica selected", balancer.ErrAllReplicasFailed, ClassUnavailable},
+		{"other replica open", fmt.Errorf("%w: %w", balancer.ErrAllReplicasFailed, breaker.ErrCircuitOpen), ClassUnavailable},
+		{
+			"executed with server error",
+			fmt.Errorf("%w: %w: %w", balancer.ErrAllReplicasFailed, balancer.ErrReplicaFailed, http.ErrInternalServerError),
+			ClassServerError,
+		},
+		{
+			"executed then other replica full",
+			fmt.Errorf("%w (default replica: %w: %w)", balancer.ErrBulkheadFull, balancer.ErrReplicaFailed, errors.New("POST request failed with status 503")),
+			ClassOther,
+		},
+		{"other", errors.New("boom"), ClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Fatalf("Classify(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// Um processor que rejeita o pagamento com 5xx consome tentativas mesmo com a outra
+// réplica indisponível, para o pagamento chegar na dead letter queue
+func TestClassifyExecutedRequestWithOtherReplicaOpen(t *testing.T) {
+	for _, status := range []int{nethttp.StatusInternalServerError, nethttp.StatusServiceUnavailable} {
+		srv := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+			w.WriteHeader(status)
+		}))
+
+		hostCfg := &http.HostCfg{
+			Addr:     strings.TrimPrefix(srv.URL, "http://"),
+			Endpoint: srv.URL + "/payments",
+		}
+		t.Setenv("LB_STRATEGY", balancer.StrategyDefaultFirst)
+		lb := balancer.NewLoadBalancer(hostCfg, hostCfg, 0.25, 100_000_000)
+		lb.FallbackReplica.CircuitBreaker.Trip()
+
+		_, err := lb.MakeRequest([]byte(`{}`), nil)
+		if !errors.Is(err, balancer.ErrAllReplicasFailed) {
+			t.Fatalf("status %d: expected ErrAllReplicasFailed, got %v", status, err)
+		}
+		if Classify(err) == ClassUnavailable {
+			t.Fatalf("status %d: executed request classified as unavailable: %v", status, err)
+		}
+
+		srv.Close()
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/balancer"
+)
+
+// Exige "Authorization: Bearer <ADMIN_TOKEN>" nas rotas administrativas. Sem o
+// token configurado as rotas ficam desabilitadas
+func (s *Server) requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			writeJSONError(w, http.StatusForbidden, "ADMIN_TOKEN not configured")
+			return
+		}
+
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (s *Server) handleGetConfigReq(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.loadBalancer.Config().Payload())
+}
+
+// Atualização parcial da configuração do load balancer e dos circuit breakers.
+// Com ?broadcast=true a nova configuração é aplicada também nas outras instâncias
+func (s *Server) handleUpdateConfigReq(w http.ResponseWriter, r *http.Request) {
+	var update balancer.ConfigUpdate
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid payload: "+err.Error())
+		return
+	}
+
+	cfg, err := s.loadBalancer.ApplyConfigUpdate(update)
+	if err != nil {
+		if errors.Is(err, balancer.ErrInvalidConfig) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("broadcast") == "true" {
+		if err := balancer.PublishConfig(r.Context(), s.redisClient, cfg); err != nil {
+			log.Printf("Error broadcasting load balancer config: %v\n", err)
+			writeJSONError(w, http.StatusBadGateway, "config applied locally but broadcast failed")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, cfg.Payload())
+}
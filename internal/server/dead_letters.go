@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/worker"
+)
+
+const (
+	defaultDeadLettersLimit = 50
+	maxDeadLettersLimit     = 1000
+)
+
+type DeadLettersPayload struct {
+	Total  int64                `json:"total"`
+	Offset int64                `json:"offset"`
+	Items  []*worker.DeadLetter `json:"items"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	resData, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to parse response: %s\n", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resData)
+}
+
+func parseIntParam(r *http.Request, name string, fallback int64) (int64, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New("Invalid query param: " + name)
+	}
+
+	return value, nil
+}
+
+func (s *Server) writeDeadLetterError(w http.ResponseWriter, err error) {
+	if errors.Is(err, worker.ErrDeadLetterNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	log.Printf("Dead letter queue operation failed: %v\n", err)
+	writeJSONError(w, http.StatusInternalServerError, "dead letter queue operation failed")
+}
+
+func (s *Server) handleListDeadLettersReq(w http.ResponseWriter, r *http.Request) {
+	offset, err := parseIntParam(r, "offset", 0)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, err := parseIntParam(r, "limit", defaultDeadLettersLimit)
+	if err != nil || limit == 0 {
+		writeJSONError(w, http.StatusBadRequest, "Invalid query param: limit")
+		return
+	}
+	limit = min(limit, maxDeadLettersLimit)
+
+	total, err := s.deadLetters.Len(r.Context())
+	if err != nil {
+		s.writeDeadLetterError(w, err)
+		return
+	}
+
+	items, err := s.deadLetters.List(r.Context(), offset, limit)
+	if err != nil {
+		s.writeDeadLetterError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, DeadLettersPayload{
+		Total:  total,
+		Offset: offset,
+		Items:  items,
+	})
+}
+
+func (s *Server) handleGetDeadLetterReq(w http.ResponseWriter, r *http.Request) {
+	deadLetter, err := s.deadLetters.Get(r.Context(), r.PathValue("correlationId"))
+	if err != nil {
+		s.writeDeadLetterError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, deadLetter)
+}
+
+func (s *Server) handleReplayDeadLetterReq(w http.ResponseWriter, r *http.Request) {
+	correlationID := r.PathValue("correlationId")
+	if err := s.deadLetters.Replay(r.Context(), correlationID); err != nil {
+		s.writeDeadLetterError(w, err)
+		return
+	}
+
+	log.Printf("Dead letter %v replayed\n", correlationID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDiscardDeadLetterReq(w http.ResponseWriter, r *http.Request) {
+	correlationID := r.PathValue("correlationId")
+	if err := s.deadLetters.Discard(r.Context(), correlationID); err != nil {
+		s.writeDeadLetterError(w, err)
+		return
+	}
+
+	log.Printf("Dead letter %v discarded\n", correlationID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+)
+
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusDown = "down"
+)
+
+// Tempo máximo de cada verificação do /readyz
+const readinessCheckTimeout = 500 * time.Millisecond
+
+// Verificação de um componente da instância. Retorna nil quando o componente está pronto
+type ReadinessCheck func(ctx context.Context) error
+
+type readinessCheck struct {
+	check ReadinessCheck
+	// a instância recusa pagamentos enquanto o componente estiver indisponível
+	gatesIngress bool
+}
+
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthPayload struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+// Registra uma verificação executada pelo /readyz. Enquanto ela falhar a instância
+// responde 503 aos pagamentos, para o nginx tentar a outra. Deve ser chamado antes do Start
+func (s *Server) AddReadinessCheck(name string, check ReadinessCheck) {
+	s.readinessChecks[name] = readinessCheck{check: check, gatesIngress: true}
+}
+
+// Registra uma verificação que aparece no /readyz mas não faz a instância recusar
+// pagamentos: é o caso de falhas que afetam todas as instâncias igualmente, como a
+// indisponibilidade dos processors, que a fila absorve
+func (s *Server) AddDegradedCheck(name string, check ReadinessCheck) {
+	s.readinessChecks[name] = readinessCheck{check: check}
+}
+
+// O processo está respondendo
+func (s *Server) handleHealthReq(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthPayload{Status: HealthStatusOK})
+}
+
+// Executa todas as verificações. accepting indica se as verificações que controlam
+// a entrada de pagamentos passaram
+func (s *Server) checkReadiness(ctx context.Context) (payload HealthPayload, accepting bool) {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	accepting = true
+	payload = HealthPayload{
+		Status:     HealthStatusOK,
+		Components: make(map[string]ComponentStatus, len(s.readinessChecks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, rc := range s.readinessChecks {
+		wg.Add(1)
+		go func(name string, rc readinessCheck) {
+			defer wg.Done()
+
+			status := ComponentStatus{Status: HealthStatusOK}
+			if err := rc.check(ctx); err != nil {
+				status = ComponentStatus{Status: HealthStatusDown, Error: err.Error()}
+			}
+
+			mu.Lock()
+			payload.Components[name] = status
+			if status.Status != HealthStatusOK {
+				payload.Status = HealthStatusDown
+				if rc.gatesIngress {
+					accepting = false
+				}
+			}
+			mu.Unlock()
+		}(name, rc)
+	}
+	wg.Wait()
+
+	return payload, accepting
+}
+
+// Reavalia periodicamente se a instância aceita pagamentos. O resultado fica em cache
+// para não executar as verificações a cada pagamento
+func (s *Server) WatchReadiness(ctx context.Context) {
+	interval := utils.GetenvDuration("READINESS_CHECK_INTERVAL", "1s")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, accepting := s.checkReadiness(ctx)
+		if s.accepting.Swap(accepting) != accepting {
+			if accepting {
+				log.Println("Instance ready: accepting payments")
+			} else {
+				log.Println("Instance not ready: rejecting payments with 503")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// A instância está pronta para receber pagamentos: todas as verificações passaram
+func (s *Server) handleReadyReq(w http.ResponseWriter, r *http.Request) {
+	payload, _ := s.checkReadiness(r.Context())
+
+	status := http.StatusOK
+	if payload.Status != HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, payload)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const IdempotencyKeyPrefix = "idempotency:"
+
+// Registra o horário de aceite do pagamento somente se o correlationId ainda não
+// tiver sido aceito na janela. Retorna o horário de aceite original em caso de duplicata
+const claimIdempotencyLuaScript = `
+local acceptedAt = redis.call('GET', KEYS[1])
+if acceptedAt then
+	return acceptedAt
+end
+
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+
+return false
+`
+
+var claimIdempotencyScript = redis.NewScript(claimIdempotencyLuaScript)
+
+type ConflictPayload struct {
+	Error         string `json:"error"`
+	CorrelationID string `json:"correlationId"`
+	AcceptedAt    string `json:"acceptedAt"`
+}
+
+type idempotency struct {
+	enabled     bool
+	window      time.Duration
+	redisClient *redis.Client
+}
+
+func newIdempotency(rc *redis.Client) *idempotency {
+	// o script usa PX em ms: uma janela zerada faria o SET falhar
+	window := max(utils.GetenvDuration("IDEMPOTENCY_WINDOW", "1h"), time.Millisecond)
+
+	return &idempotency{
+		enabled:     utils.Getenv("INGRESS_IDEMPOTENCY", "false") == "true",
+		window:      window,
+		redisClient: rc,
+	}
+}
+
+// Reserva o correlationId no ingress. Retorna o horário de aceite original quando o
+// pagamento já foi aceito dentro da janela
+func (i *idempotency) claim(ctx context.Context, correlationID string) (acceptedAt string, duplicate bool, err error) {
+	acceptedAt, err = claimIdempotencyScript.Run(ctx, i.redisClient,
+		[]string{IdempotencyKeyPrefix + correlationID},
+		time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		i.window.Milliseconds(),
+	).Text()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return acceptedAt, true, nil
+}
+
+// Libera o correlationId quando o pagamento não chegou a ser enfileirado,
+// permitindo que o cliente envie de novo
+func (i *idempotency) release(correlationID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	if err := i.redisClient.Del(ctx, IdempotencyKeyPrefix+correlationID).Err(); err != nil {
+		log.Printf("Failed to release idempotency key for %v: %v\n", correlationID, err)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// O handler de pagamentos faz flush do 204 antes de ler o payload
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Permite ao http.ResponseController acessar o writer original
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Registra a rota com contagem de requisições por status e tempo de resposta.
+// O label route é o padrão registrado, não o path, para não criar uma série por correlationId
+func (s *Server) handle(pattern string, handler http.HandlerFunc) {
+	duration := metrics.IngressDuration.With(pattern)
+
+	http.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		handler(rec, r)
+
+		duration.Observe(time.Since(start).Seconds())
+		metrics.IngressRequests.With(pattern, strconv.Itoa(rec.status)).Inc()
+	})
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Limite de pontos por consulta para evitar varrer janelas muito grandes com step pequeno
+const maxSeriesPoints = 3600
+
+var seriesSteps = map[string]time.Duration{
+	"1s": time.Second,
+	"1m": time.Minute,
+	"1h": time.Hour,
+}
+
+type SeriesBucket struct {
+	Start    string          `json:"start"`
+	Default  PaymentsSummary `json:"default"`
+	Fallback PaymentsSummary `json:"fallback"`
+}
+
+type SeriesPayload struct {
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Step    string         `json:"step"`
+	Buckets []SeriesBucket `json:"buckets"`
+}
+
+func parseTimeParam(r *http.Request, name string) (time.Time, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return time.Time{}, fmt.Errorf("Missing query param: %s", name)
+	}
+
+	parsedTime, err := time.Parse(time.RFC3339Nano, param)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid query param: %s", name)
+	}
+
+	return parsedTime, nil
+}
+
+func (s *Server) handleSeriesReq(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, err := parseTimeParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeParam(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if to.Before(from) {
+		http.Error(w, "Invalid query params: to must not be before from", http.StatusBadRequest)
+		return
+	}
+
+	stepParam := r.URL.Query().Get("step")
+	if stepParam == "" {
+		stepParam = "1s"
+	}
+
+	step, ok := seriesSteps[stepParam]
+	if !ok {
+		http.Error(w, "Invalid query param: step (allowed: 1s, 1m, 1h)", http.StatusBadRequest)
+		return
+	}
+
+	tsFromMilli := from.UnixMilli()
+	tsToMilli := to.UnixMilli()
+	stepMilli := step.Milliseconds()
+
+	// buckets alinhados ao step, o primeiro e o último são recortados pela janela
+	firstBucket := tsFromMilli - tsFromMilli%stepMilli
+	if (tsToMilli-firstBucket)/stepMilli+1 > maxSeriesPoints {
+		http.Error(w, fmt.Sprintf("Too many points: at most %d buckets per query", maxSeriesPoints), http.StatusBadRequest)
+		return
+	}
+
+	points, err := s.results.Series(context.Background(), tsFromMilli, tsToMilli, stepMilli)
+	if err != nil {
+		log.Printf("Failed to retrieve payments series: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	series := SeriesPayload{
+		From:    from.UTC().Format(time.RFC3339Nano),
+		To:      to.UTC().Format(time.RFC3339Nano),
+		Step:    stepParam,
+		Buckets: make([]SeriesBucket, 0, len(points)),
+	}
+
+	for _, point := range points {
+		series.Buckets = append(series.Buckets, SeriesBucket{
+			Start:    time.UnixMilli(point.Start).UTC().Format(time.RFC3339Nano),
+			Default:  newPaymentsSummary(point.Default),
+			Fallback: newPaymentsSummary(point.Fallback),
+		})
+	}
+
+	resData, err := json.Marshal(series)
+	if err != nil {
+		log.Printf("Failed to parse series response: %s\n", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resData)
+}
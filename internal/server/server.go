@@ -3,42 +3,82 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/balancer"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/dedup"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/money"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/queue"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/results"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/tracker"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/worker"
 
 	"github.com/redis/go-redis/v9"
 )
 
-type Server struct {
-	defaultAmountKey   string
-	fallbackAmountKey  string
-	defaultCounterKey  string
-	fallbackCounterKey string
-	workQueueKey       string
-	resultsHandler     *worker.ResultsHandler
-	redisClient        *redis.Client
-}
-
-type decimalAmount float64
+const (
+	// Responde 204 imediatamente e enfileira o pagamento em background
+	AckModeAsync = "async"
+	// Responde 204 somente após o pagamento ser persistido na fila
+	AckModeDurable = "durable"
+)
 
-func (da decimalAmount) MarshalJSON() ([]byte, error) {
-	return fmt.Appendf(nil, "%.2f", da), nil
+type Server struct {
+	queue           queue.Queue
+	strictIngress   bool
+	ackMode         string
+	enqueueTimeout  time.Duration
+	results         results.Store
+	tracker         *tracker.Tracker
+	deadLetters     *worker.DeadLetterQueue
+	idempotency     *idempotency
+	pending         sync.WaitGroup // enfileiramentos em background ainda não concluídos
+	readinessChecks map[string]readinessCheck
+	accepting       atomic.Bool // resultado em cache das verificações que controlam a entrada
+	loadBalancer    *balancer.LoadBalancer
+	adminToken      string
+	srv             *http.Server
+	redisClient     *redis.Client
 }
 
-func (da decimalAmount) String() string {
-	return fmt.Sprintf("%.2f", da)
+// Remove a fila de trabalho e todos os buckets de resultados em uma única operação
+// e notifica as instâncias para limparem o estado local
+const purgeLuaScript = `
+local purged = redis.call('DEL', KEYS[1])
+local channel = ARGV[1]
+
+for i = 2, #ARGV do
+	local cursor = '0'
+	repeat
+		local res = redis.call('SCAN', cursor, 'MATCH', ARGV[i], 'COUNT', 1000)
+		cursor = res[1]
+		for _, key in ipairs(res[2]) do
+			purged = purged + redis.call('DEL', key)
+		end
+	until cursor == '0'
+end
+
+redis.call('PUBLISH', channel, 'purge')
+
+return purged
+`
+
+type ErrorPayload struct {
+	Error string `json:"error"`
 }
 
 type PaymentsSummary struct {
-	TotalRequests int64         `json:"totalRequests"`
-	TotalAmount   decimalAmount `json:"totalAmount"`
+	TotalRequests int64       `json:"totalRequests"`
+	TotalAmount   money.Cents `json:"totalAmount"`
 }
 
 type SummaryPayload struct {
@@ -46,75 +86,74 @@ type SummaryPayload struct {
 	Fallback PaymentsSummary `json:"fallback"`
 }
 
-func NewServer(queuePrefix string, redisClient *redis.Client, resultsHandler *worker.ResultsHandler) *Server {
-	return &Server{
-		defaultAmountKey:   "amount:default:counter",
-		fallbackAmountKey:  "amount:fallback:counter",
-		defaultCounterKey:  "default:counter",
-		fallbackCounterKey: "fallback:counter",
-		workQueueKey:       "work_queue",
-		resultsHandler:     resultsHandler,
-		redisClient:        redisClient,
+func NewServer(queuePrefix string, redisClient *redis.Client, workQueue queue.Queue, resultsStore results.Store, paymentTracker *tracker.Tracker, deadLetters *worker.DeadLetterQueue, loadBalancer *balancer.LoadBalancer) *Server {
+	ackMode := utils.Getenv("ACK_MODE", AckModeAsync)
+	if ackMode != AckModeAsync && ackMode != AckModeDurable {
+		log.Printf("Invalid ACK_MODE %q: using %q\n", ackMode, AckModeAsync)
+		ackMode = AckModeAsync
 	}
-}
 
-func (s *Server) EnqueueRequest(reqPayload []byte) error {
-	return s.redisClient.RPush(context.Background(), s.workQueueKey, reqPayload).Err()
+	enqueueTimeout := utils.GetenvDuration("ENQUEUE_TIMEOUT", "1s")
+
+	s := &Server{
+		queue:          workQueue,
+		strictIngress:  utils.Getenv("STRICT_INGRESS", "false") == "true",
+		ackMode:        ackMode,
+		enqueueTimeout: enqueueTimeout,
+		results:        resultsStore,
+		tracker:        paymentTracker,
+		deadLetters:    deadLetters,
+		idempotency:    newIdempotency(redisClient),
+		readinessChecks: map[string]readinessCheck{
+			"redis": {
+				check: func(ctx context.Context) error {
+					return redisClient.Ping(ctx).Err()
+				},
+				gatesIngress: true,
+			},
+		},
+		loadBalancer: loadBalancer,
+		adminToken:   utils.Getenv("ADMIN_TOKEN", ""),
+		srv: &http.Server{
+			Addr:         ":8081",
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  120 * time.Second,
+		},
+		redisClient: redisClient,
+	}
+	// até a primeira verificação do WatchReadiness a instância aceita pagamentos
+	s.accepting.Store(true)
+
+	return s
 }
 
-func (s *Server) handleCountCmd(cmd *redis.SliceCmd) (int64, error) {
-	if cmd == nil {
-		return int64(0), nil
+func (s *Server) EnqueueRequest(ctx context.Context, reqPayload []byte) error {
+	if worker.IsRetryEntry(reqPayload) {
+		return worker.ErrReservedPayload
 	}
 
-	result, err := cmd.Result()
-	if err != nil {
-		return 0, err
+	if err := s.queue.Enqueue(ctx, reqPayload); err != nil {
+		return err
 	}
 
-	count := int64(0)
-	var intVal int64
-	for _, val := range result {
-		if val == nil {
-			continue
+	if s.tracker.Enabled() {
+		var payload struct {
+			CorrelationID string `json:"correlationId"`
 		}
-
-		if intVal, err = strconv.ParseInt(val.(string), 10, 64); err != nil {
-			return 0, err
+		if err := json.Unmarshal(reqPayload, &payload); err == nil {
+			s.tracker.Queued(ctx, payload.CorrelationID)
 		}
-
-		count += intVal
 	}
 
-	return count, nil
+	return nil
 }
 
-func (s *Server) handleSumCmd(cmd *redis.SliceCmd) (float64, error) {
-	if cmd == nil {
-		return 0.0, nil
-	}
-
-	result, err := cmd.Result()
-	if err != nil {
-		return 0.0, err
+func newPaymentsSummary(totals results.ProcessorTotals) PaymentsSummary {
+	return PaymentsSummary{
+		TotalRequests: totals.Count,
+		TotalAmount:   totals.Amount,
 	}
-
-	sum := 0.0
-	var floatVal float64
-	for _, val := range result {
-
-		if val == nil {
-			continue
-		}
-
-		if floatVal, err = strconv.ParseFloat(val.(string), 64); err != nil {
-			return 0, err
-		}
-
-		sum += floatVal
-	}
-
-	return sum, nil
 }
 
 func (s *Server) handleSummaryReq(w http.ResponseWriter, r *http.Request) {
@@ -135,6 +174,7 @@ func (s *Server) handleSummaryReq(w http.ResponseWriter, r *http.Request) {
 		parsedTime, err := time.Parse(time.RFC3339Nano, paramFrom)
 		if err != nil {
 			http.Error(w, "Invalid query param: from", http.StatusBadRequest)
+			return
 		}
 
 		tsFromMilli = parsedTime.UnixMilli()
@@ -143,100 +183,149 @@ func (s *Server) handleSummaryReq(w http.ResponseWriter, r *http.Request) {
 		parsedTime, err := time.Parse(time.RFC3339Nano, paramTo)
 		if err != nil {
 			http.Error(w, "Invalid query param: to", http.StatusBadRequest)
+			return
 		}
 
 		tsToMilli = parsedTime.UnixMilli()
 	}
 
-	ctx := context.Background()
-
-	pipe := s.redisClient.Pipeline()
-	defaultSumCmd := s.resultsHandler.ResultsCountByRangePipe(pipe, ctx, s.defaultAmountKey, tsFromMilli, tsToMilli)
-	fallbackSumCmd := s.resultsHandler.ResultsCountByRangePipe(pipe, ctx, s.fallbackAmountKey, tsFromMilli, tsToMilli)
-
-	defaultCountCmd := s.resultsHandler.ResultsCountByRangePipe(pipe, ctx, s.defaultCounterKey, tsFromMilli, tsToMilli)
-	fallbackCountCmd := s.resultsHandler.ResultsCountByRangePipe(pipe, ctx, s.fallbackCounterKey, tsFromMilli, tsToMilli)
-
-	_, err := pipe.Exec(ctx)
+	totals, err := s.results.Totals(context.Background(), tsFromMilli, tsToMilli)
 	if err != nil {
-		log.Printf("Failed to retrieve payment summary. redis pipeline failed: %v\n", err)
+		log.Printf("Failed to retrieve payment summary: %v\n", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	summary := SummaryPayload{
-		Default:  PaymentsSummary{},
-		Fallback: PaymentsSummary{},
+		Default:  newPaymentsSummary(totals.Default),
+		Fallback: newPaymentsSummary(totals.Fallback),
 	}
 
-	var wg sync.WaitGroup
+	resData, err := json.Marshal(summary)
+	if err != nil {
+		log.Printf("Failed to parse summary response: %s\n", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	wg.Add(1)
-	go func(cmd *redis.SliceCmd) {
-		defer wg.Done()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resData)
+}
 
-		count, err := s.handleCountCmd(cmd)
-		if err != nil {
-			log.Printf("Failed to handle default counter: %v", err)
-			return
-		}
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	resData, _ := json.Marshal(ErrorPayload{Error: message})
 
-		summary.Default.TotalRequests = count
-	}(defaultCountCmd)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(resData)
+}
 
-	wg.Add(1)
-	go func(cmd *redis.SliceCmd) {
-		defer wg.Done()
+// Lê o payload antes de responder. No modo strict o payload é validado, com idempotência
+// o correlationId é reservado (409 para duplicatas) e no modo durable a resposta só é
+// enviada após o pagamento ser persistido na fila
+func (s *Server) handleAckedPaymentReq(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
 
-		count, err := s.handleCountCmd(cmd)
-		if err != nil {
-			log.Printf("Failed to handle fallback counter: %v", err)
-			return
-		}
+	payload, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
 
-		summary.Fallback.TotalRequests = count
-	}(fallbackCountCmd)
+	if worker.IsRetryEntry(payload) {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON payload")
+		return
+	}
 
-	wg.Add(1)
-	go func(cmd *redis.SliceCmd) {
-		defer wg.Done()
+	var workPayload worker.WorkPayload
+	if s.strictIngress {
+		if err = json.Unmarshal(payload, &workPayload); err != nil {
+			if errors.Is(err, money.ErrTooManyDecimal) {
+				writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
 
-		sum, err := s.handleSumCmd(cmd)
-		if err != nil {
-			log.Printf("Failed to handle default summary sum: %v\n", err)
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON payload")
 			return
 		}
 
-		summary.Default.TotalAmount = decimalAmount(sum)
-	}(defaultSumCmd)
-
-	wg.Add(1)
-	go func(cmd *redis.SliceCmd) {
-		defer wg.Done()
+		if err = workPayload.Validate(); err != nil {
+			writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	} else if s.idempotency.enabled {
+		// sem validação: payloads sem correlationId seguem sem reserva
+		json.Unmarshal(payload, &workPayload)
+	}
 
-		sum, err := s.handleSumCmd(cmd)
+	correlationID := workPayload.CorrelationID
+	claimed := false
+	if s.idempotency.enabled && correlationID != "" {
+		acceptedAt, duplicate, err := s.idempotency.claim(r.Context(), correlationID)
 		if err != nil {
-			log.Printf("Failed to handle fallback summary sum: %v\n", err)
+			// sem redis a deduplicação dos workers ainda descarta a duplicata
+			log.Printf("Failed to claim idempotency key for %v: %v\n", correlationID, err)
+		} else if duplicate {
+			writeJSON(w, http.StatusConflict, ConflictPayload{
+				Error:         "payment already accepted",
+				CorrelationID: correlationID,
+				AcceptedAt:    acceptedAt,
+			})
 			return
+		} else {
+			claimed = true
 		}
+	}
 
-		summary.Fallback.TotalAmount = decimalAmount(sum)
-	}(fallbackSumCmd)
+	if s.ackMode == AckModeDurable {
+		ctx, cancel := context.WithTimeout(r.Context(), s.enqueueTimeout)
+		defer cancel()
 
-	wg.Wait()
+		if err = s.EnqueueRequest(ctx, payload); err != nil {
+			log.Printf("Failed to push request to queue: %s\n", err.Error())
+			if claimed {
+				s.idempotency.release(correlationID)
+			}
+			writeJSONError(w, http.StatusServiceUnavailable, "payment could not be queued")
+			return
+		}
 
-	resData, err := json.Marshal(summary)
-	if err != nil {
-		log.Printf("Failed to parse summary response: %s\n", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(resData)
+	w.WriteHeader(http.StatusNoContent)
+
+	s.pending.Add(1)
+	go func(payload []byte) {
+		defer s.pending.Done()
+
+		err := s.EnqueueRequest(context.Background(), payload)
+		if err != nil {
+			log.Printf("Failed to push request to queue: %s\n", err.Error())
+			if claimed {
+				s.idempotency.release(correlationID)
+			}
+		}
+	}(payload)
 }
 
 func (s *Server) handlePaymentReq(w http.ResponseWriter, r *http.Request) {
+	if !s.accepting.Load() {
+		// o nginx repassa a requisição para a outra instância (proxy_next_upstream)
+		writeJSONError(w, http.StatusServiceUnavailable, "instance not ready")
+		return
+	}
+
+	if s.strictIngress || s.ackMode == AckModeDurable || s.idempotency.enabled {
+		s.handleAckedPaymentReq(w, r)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
@@ -252,25 +341,123 @@ func (s *Server) handlePaymentReq(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.pending.Add(1)
 	go func(payload []byte) {
-		err = s.EnqueueRequest(payload)
+		defer s.pending.Done()
+
+		err := s.EnqueueRequest(context.Background(), payload)
 		if err != nil {
 			log.Printf("Failed to push request to queue: %s\n", err.Error())
 		}
 	}(payload)
 }
 
-func (s *Server) Start() {
-	srv := &http.Server{
-		Addr:         ":8081",
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  120 * time.Second,
+func (s *Server) handleStatusReq(w http.ResponseWriter, r *http.Request) {
+	status, err := s.tracker.Get(r.Context(), r.PathValue("correlationId"))
+	if err != nil {
+		switch {
+		case errors.Is(err, tracker.ErrPaymentNotFound):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, tracker.ErrTrackingDisabled):
+			writeJSONError(w, http.StatusNotImplemented, err.Error())
+		default:
+			log.Printf("Failed to retrieve payment status: %v\n", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to retrieve payment status")
+		}
+		return
+	}
+
+	resData, err := json.Marshal(status)
+	if err != nil {
+		log.Printf("Failed to parse payment status response: %s\n", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resData)
+}
+
+func (s *Server) handlePurgeReq(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	purged, err := s.redisClient.Eval(r.Context(), purgeLuaScript,
+		[]string{queue.WorkQueueKey},
+		worker.PurgeChannel,
+		results.KeyPrefix+"*",
+		queue.ProcessingKeyPrefix+"*",
+		worker.DeadLetterKey,
+		queue.RetryQueueKey,
+		tracker.KeyPrefix+"*",
+		dedup.KeyPrefix+"*",
+		IdempotencyKeyPrefix+"*",
+		balancer.SharedStatsKeyPrefix+"*",
+	).Int64()
+	if err != nil {
+		log.Printf("Failed to purge payments: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	http.HandleFunc("/payments", s.handlePaymentReq)
-	http.HandleFunc("/payments-summary", s.handleSummaryReq)
+	log.Printf("Payments purged: %d keys removed\n", purged)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(fmt.Appendf(nil, `{"purgedKeys":%d}`, purged))
+}
+
+func (s *Server) Start() {
+	s.handle("GET /healthz", s.handleHealthReq)
+	s.handle("GET /metrics", metrics.Default.Handler())
+	s.handle("GET /readyz", s.handleReadyReq)
+	s.handle("/payments", s.handlePaymentReq)
+	s.handle("/payments-summary", s.handleSummaryReq)
+	s.handle("/payments-summary/series", s.handleSeriesReq)
+	s.handle("/purge-payments", s.handlePurgeReq)
+	s.handle("GET /payments/{correlationId}", s.handleStatusReq)
+	s.handle("GET /admin/dead-letters", s.requireAdmin(s.handleListDeadLettersReq))
+	s.handle("GET /admin/dead-letters/{correlationId}", s.requireAdmin(s.handleGetDeadLetterReq))
+	s.handle("POST /admin/dead-letters/{correlationId}/replay", s.requireAdmin(s.handleReplayDeadLetterReq))
+	s.handle("DELETE /admin/dead-letters/{correlationId}", s.requireAdmin(s.handleDiscardDeadLetterReq))
+	s.handle("GET /admin/config", s.requireAdmin(s.handleGetConfigReq))
+	s.handle("PATCH /admin/config", s.requireAdmin(s.handleUpdateConfigReq))
 
 	log.Println("Server starting on :8081")
-	log.Fatal(srv.ListenAndServe())
+	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// Para de aceitar conexões, aguarda as requisições em andamento e os pagamentos
+// que ainda estão sendo enfileirados em background
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.srv.Shutdown(ctx)
+
+	// pagamentos já confirmados com 204 ainda precisam chegar na fila, mesmo se o
+	// deadline expirou aguardando as conexões. Nesse caso espera no máximo ENQUEUE_TIMEOUT
+	waitCtx := ctx
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(context.Background(), s.enqueueTimeout)
+		defer cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-waitCtx.Done():
+		if err == nil {
+			return fmt.Errorf("waiting for pending enqueues: %w", waitCtx.Err())
+		}
+		return fmt.Errorf("%w (pending enqueues not finished)", err)
+	}
+
+	return err
 }
@@ -0,0 +1,181 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+type PaymentState string
+
+const (
+	StateQueued            PaymentState = "queued"
+	StateInFlight          PaymentState = "in_flight"
+	StateProcessedDefault  PaymentState = "processed_default"
+	StateProcessedFallback PaymentState = "processed_fallback"
+	StateRetrying          PaymentState = "retrying"
+	StateFailed            PaymentState = "failed"
+)
+
+const KeyPrefix = "payment:"
+
+const timestampLayout = "2006-01-02T15:04:05.000Z"
+
+var (
+	ErrPaymentNotFound  = errors.New("payment not found")
+	ErrTrackingDisabled = errors.New("payment tracking is disabled")
+)
+
+// Atualiza o estado de um pagamento. Estados processed_* são finais e o
+// estado queued nunca sobrescreve um estado já registrado (o enqueue é assíncrono)
+const trackLuaScript = `
+local key = KEYS[1]
+local state = ARGV[1]
+local now = ARGV[2]
+local ttl = tonumber(ARGV[3])
+local processor = ARGV[4]
+local lastError = ARGV[5]
+
+local current = redis.call('HGET', key, 'state')
+if current == 'processed_default' or current == 'processed_fallback' then
+	return 0
+end
+
+if state == 'queued' then
+	if current then
+		return 0
+	end
+	redis.call('HSET', key, 'state', state, 'attempts', 0, 'queuedAt', now, 'updatedAt', now)
+elseif state == 'in_flight' then
+	redis.call('HINCRBY', key, 'attempts', 1)
+	redis.call('HSET', key, 'state', state, 'lastAttemptAt', now, 'updatedAt', now)
+elseif state == 'processed_default' or state == 'processed_fallback' then
+	redis.call('HSET', key, 'state', state, 'processor', processor, 'processedAt', now, 'updatedAt', now)
+else
+	redis.call('HSET', key, 'state', state, 'lastError', lastError, 'updatedAt', now)
+end
+
+redis.call('PEXPIRE', key, ttl)
+
+return 1
+`
+
+type PaymentStatus struct {
+	CorrelationID string       `json:"correlationId"`
+	State         PaymentState `json:"state"`
+	Processor     string       `json:"processor,omitempty"`
+	Attempts      int64        `json:"attempts"`
+	QueuedAt      string       `json:"queuedAt,omitempty"`
+	LastAttemptAt string       `json:"lastAttemptAt,omitempty"`
+	ProcessedAt   string       `json:"processedAt,omitempty"`
+	UpdatedAt     string       `json:"updatedAt,omitempty"`
+	LastError     string       `json:"lastError,omitempty"`
+}
+
+type Tracker struct {
+	enabled     bool
+	ttl         time.Duration
+	script      *redis.Script
+	redisClient *redis.Client
+}
+
+func NewTracker(rc *redis.Client) *Tracker {
+	ttl := utils.GetenvDuration("PAYMENT_TRACKING_TTL", "1h")
+
+	return &Tracker{
+		enabled:     utils.Getenv("PAYMENT_TRACKING", "false") == "true",
+		ttl:         ttl,
+		script:      redis.NewScript(trackLuaScript),
+		redisClient: rc,
+	}
+}
+
+func (t *Tracker) Enabled() bool {
+	return t != nil && t.enabled
+}
+
+func (t *Tracker) track(ctx context.Context, correlationID string, state PaymentState, processor, lastError string) {
+	if !t.Enabled() || correlationID == "" {
+		return
+	}
+
+	err := t.script.Run(ctx, t.redisClient,
+		[]string{KeyPrefix + correlationID},
+		string(state),
+		time.Now().UTC().Format(timestampLayout),
+		t.ttl.Milliseconds(),
+		processor,
+		lastError,
+	).Err()
+	if err != nil {
+		log.Printf("Failed to track payment %v as %v: %v\n", correlationID, state, err)
+	}
+}
+
+func (t *Tracker) Queued(ctx context.Context, correlationID string) {
+	t.track(ctx, correlationID, StateQueued, "", "")
+}
+
+func (t *Tracker) InFlight(ctx context.Context, correlationID string) {
+	t.track(ctx, correlationID, StateInFlight, "", "")
+}
+
+func (t *Tracker) Retrying(ctx context.Context, correlationID string, cause error) {
+	t.track(ctx, correlationID, StateRetrying, "", errorMessage(cause))
+}
+
+func (t *Tracker) Failed(ctx context.Context, correlationID string, cause error) {
+	t.track(ctx, correlationID, StateFailed, "", errorMessage(cause))
+}
+
+func (t *Tracker) Processed(ctx context.Context, correlationID string, processor string) {
+	state := StateProcessedDefault
+	if processor == http.FallbackHost {
+		state = StateProcessedFallback
+	}
+
+	t.track(ctx, correlationID, state, processor, "")
+}
+
+func (t *Tracker) Get(ctx context.Context, correlationID string) (*PaymentStatus, error) {
+	if !t.Enabled() {
+		return nil, ErrTrackingDisabled
+	}
+
+	fields, err := t.redisClient.HGetAll(ctx, KeyPrefix+correlationID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrPaymentNotFound
+	}
+
+	attempts, _ := strconv.ParseInt(fields["attempts"], 10, 64)
+
+	return &PaymentStatus{
+		CorrelationID: correlationID,
+		State:         PaymentState(fields["state"]),
+		Processor:     fields["processor"],
+		Attempts:      attempts,
+		QueuedAt:      fields["queuedAt"],
+		LastAttemptAt: fields["lastAttemptAt"],
+		ProcessedAt:   fields["processedAt"],
+		UpdatedAt:     fields["updatedAt"],
+		LastError:     fields["lastError"],
+	}, nil
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
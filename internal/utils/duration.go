@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"log"
+	"time"
+)
+
+// Lê uma duração positiva do ambiente. Valores inválidos, zerados ou negativos usam o fallback
+func GetenvDuration(key, fallback string) time.Duration {
+	value := Getenv(key, fallback)
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("[ENV WARN] Invalid %s %q. Using fallback value: %s", key, value, fallback)
+		d, _ = time.ParseDuration(fallback)
+	}
+
+	return d
+}
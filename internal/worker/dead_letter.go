@@ -0,0 +1,225 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+const DeadLetterKey = "work_queue:dead"
+
+var (
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	ErrReservedPayload    = errors.New("payload starts with a reserved byte")
+)
+
+// Entrada da fila de trabalho para pagamentos que já falharam ao menos uma vez, prefixada
+// por um byte que não inicia um JSON válido. Pagamentos novos são enfileirados com o
+// payload original (attempts = 0)
+type retryEnvelope struct {
+	Attempts  int             `json:"attempts"`
+	Deferrals int             `json:"deferrals,omitempty"` // retries por indisponibilidade, não contam como tentativa
+	LastError string          `json:"lastError,omitempty"`
+	Payment   json.RawMessage `json:"payment"`
+}
+
+const retryEnvelopeMarker byte = 0x1e
+
+// Payloads recebidos dos clientes não podem se passar por um retry (e forjar o número de tentativas)
+func IsRetryEntry(payload []byte) bool {
+	return len(payload) > 0 && payload[0] == retryEnvelopeMarker
+}
+
+// Extrai o pagamento e o número de tentativas de uma entrada da fila
+func decodeQueueEntry(raw []byte) (retryEnvelope, error) {
+	if !IsRetryEntry(raw) {
+		return retryEnvelope{Payment: raw}, nil
+	}
+
+	var envelope retryEnvelope
+	err := json.Unmarshal(raw[1:], &envelope)
+	return envelope, err
+}
+
+func encodeRetryEntry(work *Work, cause error) ([]byte, error) {
+	data, err := json.Marshal(retryEnvelope{
+		Attempts:  work.Attempts,
+		Deferrals: work.Deferrals,
+		LastError: errorMessage(cause),
+		Payment:   work.Payment,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{retryEnvelopeMarker}, data...), nil
+}
+
+type DeadLetter struct {
+	CorrelationID string          `json:"correlationId"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"lastError"`
+	FailedAt      string          `json:"failedAt"`
+	Payment       json.RawMessage `json:"payment"`
+	raw           string
+}
+
+type DeadLetterQueue struct {
+	key         string
+	queue       queue.Queue
+	redisClient *redis.Client
+}
+
+func NewDeadLetterQueue(rc *redis.Client, q queue.Queue) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		key:         DeadLetterKey,
+		queue:       q,
+		redisClient: rc,
+	}
+}
+
+func newDeadLetter(work *Work, cause error) ([]byte, error) {
+	correlationID := ""
+	if work.Payload != nil {
+		correlationID = work.Payload.CorrelationID
+	}
+
+	return json.Marshal(DeadLetter{
+		CorrelationID: correlationID,
+		Attempts:      work.Attempts,
+		LastError:     errorMessage(cause),
+		FailedAt:      time.Now().UTC().Format(time.RFC3339Nano),
+		Payment:       work.Payment,
+	})
+}
+
+func (q *DeadLetterQueue) push(ctx context.Context, entry []byte) error {
+	return q.redisClient.RPush(ctx, q.key, entry).Err()
+}
+
+func (q *DeadLetterQueue) Len(ctx context.Context) (int64, error) {
+	return q.redisClient.LLen(ctx, q.key).Result()
+}
+
+func (q *DeadLetterQueue) List(ctx context.Context, offset, limit int64) ([]*DeadLetter, error) {
+	entries, err := q.redisClient.LRange(ctx, q.key, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters := make([]*DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		deadLetter, err := parseDeadLetter(entry)
+		if err != nil {
+			continue
+		}
+
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	return deadLetters, nil
+}
+
+func (q *DeadLetterQueue) Get(ctx context.Context, correlationID string) (*DeadLetter, error) {
+	entries, err := q.redisClient.LRange(ctx, q.key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		deadLetter, err := parseDeadLetter(entry)
+		if err != nil {
+			continue
+		}
+
+		if deadLetter.CorrelationID == correlationID {
+			return deadLetter, nil
+		}
+	}
+
+	return nil, ErrDeadLetterNotFound
+}
+
+// Devolve o pagamento para a fila de trabalho com o contador de tentativas zerado
+func (q *DeadLetterQueue) Replay(ctx context.Context, correlationID string) error {
+	deadLetter, err := q.Get(ctx, correlationID)
+	if err != nil {
+		return err
+	}
+
+	// só devolve se a entrada ainda existir, evitando replay duplicado
+	if mover, ok := q.queue.(queue.ListMover); ok {
+		moved, err := mover.MoveFromList(ctx, q.key, []byte(deadLetter.raw), deadLetter.Payment)
+		if err != nil {
+			return err
+		}
+
+		if !moved {
+			return ErrDeadLetterNotFound
+		}
+
+		return nil
+	}
+
+	// fila fora do redis: a remoção e o enfileiramento não podem ser atômicos
+	removed, err := q.redisClient.LRem(ctx, q.key, 1, deadLetter.raw).Result()
+	if err != nil {
+		return err
+	}
+
+	if removed == 0 {
+		return ErrDeadLetterNotFound
+	}
+
+	if err := q.queue.Enqueue(ctx, deadLetter.Payment); err != nil {
+		// mantém o pagamento na dead letter queue para um novo replay
+		if pushErr := q.redisClient.RPush(ctx, q.key, deadLetter.raw).Err(); pushErr != nil {
+			log.Printf("Dead letter %v lost: failed to enqueue (%v) and to restore it (%v)\n", correlationID, err, pushErr)
+			return errors.Join(err, pushErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (q *DeadLetterQueue) Discard(ctx context.Context, correlationID string) error {
+	deadLetter, err := q.Get(ctx, correlationID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := q.redisClient.LRem(ctx, q.key, 1, deadLetter.raw).Result()
+	if err != nil {
+		return err
+	}
+
+	if removed == 0 {
+		return ErrDeadLetterNotFound
+	}
+
+	return nil
+}
+
+func parseDeadLetter(entry string) (*DeadLetter, error) {
+	var deadLetter DeadLetter
+	if err := json.Unmarshal([]byte(entry), &deadLetter); err != nil {
+		return nil, err
+	}
+
+	deadLetter.raw = entry
+	return &deadLetter, nil
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
@@ -9,111 +9,298 @@ import (
 	"time"
 
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/balancer"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/dedup"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/money"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/queue"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/results"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/retry"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/tracker"
 	"github.com/redis/go-redis/v9"
 )
 
 const ProcessedQueuePrefix = "processed:"
 
+// Canal onde o endpoint de purge notifica todas as instâncias
+const PurgeChannel = "purge_payments"
+
 type workResult struct {
-	amountKey   string
-	counterKey  string
-	timestamp   int64
-	amountValue float64
+	correlationID string
+	host          string
+	timestamp     int64
+	amountValue   money.Cents
 }
 
-type workStore struct {
-	sync.RWMutex
-	items map[string]bool
+type Work struct {
+	Payload   *WorkPayload
+	Raw       []byte // entrada da fila, usada para confirmar o processamento
+	Payment   []byte // payload original do pagamento
+	Attempts  int
+	Deferrals int
 }
 
-func NewWorkStore() *workStore {
-	return &workStore{
-		items: make(map[string]bool),
+type WorkPayload struct {
+	CorrelationID string      `json:"correlationId"`
+	Amount        money.Cents `json:"amount"`
+	RequestedAt   string      `json:"requestedAt"`
+}
+
+var (
+	ErrMissingCorrelationID = errors.New("correlationId is required")
+	ErrInvalidCorrelationID = errors.New("correlationId must be a valid UUID")
+	ErrInvalidAmount        = errors.New("amount must be greater than zero")
+)
+
+func (p *WorkPayload) Validate() error {
+	if p.CorrelationID == "" {
+		return ErrMissingCorrelationID
 	}
+
+	if !isValidUUID(p.CorrelationID) {
+		return ErrInvalidCorrelationID
+	}
+
+	if p.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	return nil
 }
 
-func (s *workStore) contains(key string) bool {
-	s.RLock()
-	defer s.RUnlock()
-	return s.items[key]
+// Formato canônico: xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func isValidUUID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			isHex := (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+			if !isHex {
+				return false
+			}
+		}
+	}
+
+	return true
 }
 
-func (s *workStore) add(key string) {
-	s.Lock()
-	defer s.Unlock()
-	s.items[key] = true
-	// log.Printf("%v marked as seen", key)
+type WorkerCfg struct {
+	WorkerPool    chan chan *Work
+	Queue         queue.Queue
+	MaxAttempts   int // após este número de falhas o pagamento vai para a dead letter queue
+	Dedup         *dedup.Deduplicator
+	InFlightDelay time.Duration // espera para tentar de novo um pagamento reservado por outro worker
+	InFlight      *sync.WaitGroup
+	LoadBalancer  *balancer.LoadBalancer
+	RedisClient   *redis.Client
+	Results       results.Store
+	Tracker       *tracker.Tracker
+	DeadLetters   *DeadLetterQueue
+	Backoff       *retry.Backoff
 }
 
-func (s *workStore) remove(key string) {
-	s.Lock()
-	defer s.Unlock()
-	s.items[key] = false
-	log.Printf("%v removed from seen", key)
+type Worker struct {
+	ID            int
+	chWork        chan *Work
+	WorkerPool    chan chan *Work
+	queue         queue.Queue
+	maxAttempts   int
+	dedup         *dedup.Deduplicator
+	inFlightDelay time.Duration
+	inFlight      *sync.WaitGroup
+	loadBalancer  *balancer.LoadBalancer
+	redisClient   *redis.Client
+	results       results.Store
+	tracker       *tracker.Tracker
+	deadLetters   *DeadLetterQueue
+	backoff       *retry.Backoff
 }
 
-type Work struct {
-	Payload *WorkPayload
-	Raw     []byte
+func NewWorker(id int, cfg *WorkerCfg) *Worker {
+	return &Worker{
+		ID:            id,
+		chWork:        make(chan *Work, 1),
+		queue:         cfg.Queue,
+		maxAttempts:   cfg.MaxAttempts,
+		WorkerPool:    cfg.WorkerPool,
+		dedup:         cfg.Dedup,
+		inFlightDelay: cfg.InFlightDelay,
+		inFlight:      cfg.InFlight,
+		loadBalancer:  cfg.LoadBalancer,
+		redisClient:   cfg.RedisClient,
+		results:       cfg.Results,
+		tracker:       cfg.Tracker,
+		deadLetters:   cfg.DeadLetters,
+		backoff:       cfg.Backoff,
+	}
 }
 
-type WorkPayload struct {
-	CorrelationID string  `json:"correlationId"`
-	Amount        float64 `json:"amount"`
-	RequestedAt   string  `json:"requestedAt"`
+// Falhas que não vão se resolver com uma nova tentativa
+func isPermanentFailure(err error) bool {
+	return errors.Is(err, http.ErrClientError)
 }
 
-type Worker struct {
-	ID             int
-	chWork         chan *Work
-	WorkerPool     chan chan *Work
-	workQueueKey   string
-	workStore      *workStore
-	loadBalancer   *balancer.LoadBalancer
-	redisClient    *redis.Client
-	resultsHandler *ResultsHandler
+func (w *Worker) handleProcessingFailure(work *Work, cause error) {
+	w.dedup.Release(context.Background(), work.Payload.CorrelationID)
+
+	// bulkheads cheios ou processors fora do ar não dizem nada sobre o pagamento:
+	// o retry segue com backoff sem consumir uma tentativa
+	if retry.Classify(cause) == retry.ClassUnavailable {
+		work.Deferrals++
+	} else {
+		work.Attempts++
+	}
+
+	if isPermanentFailure(cause) || work.Attempts >= w.maxAttempts {
+		w.deadLetter(work, cause)
+		return
+	}
+
+	delay := w.backoff.Delay(cause, work.Attempts+work.Deferrals)
+
+	entry, err := encodeRetryEntry(work, cause)
+	if err != nil {
+		// sem o envelope o pagamento volta como novo, perdendo a contagem de tentativas
+		log.Printf("Failed to encode retry entry for %v: %v\n", work.Payload.CorrelationID, err)
+		entry, delay = work.Raw, 0
+	}
+
+	scheduled := func() {
+		w.tracker.Retrying(context.Background(), work.Payload.CorrelationID, cause)
+		metrics.Retries.With(string(retry.Classify(cause))).Inc()
+
+		log.Printf("Processing failed for %v (attempt %d): retry scheduled in %v", work.Payload.CorrelationID, work.Attempts, delay)
+	}
+
+	requeue := func(ctx context.Context) error {
+		return w.queue.Requeue(ctx, work.Raw, entry, delay)
+	}
+
+	if err := withTimeout(requeue); err != nil {
+		log.Printf("Failed to schedule retry for %v: %v\n", work.Payload.CorrelationID, err)
+		w.async(func() { w.retryInBackground(work, requeue, scheduled) })
+		return
+	}
+
+	scheduled()
 }
 
-func NewWorker(id int, wp chan chan *Work, wqk string, ws *workStore, lb *balancer.LoadBalancer, rc *redis.Client, rh *ResultsHandler) *Worker {
-	return &Worker{
-		ID:             id,
-		chWork:         make(chan *Work, 1),
-		workQueueKey:   wqk,
-		WorkerPool:     wp,
-		workStore:      ws,
-		loadBalancer:   lb,
-		redisClient:    rc,
-		resultsHandler: rh,
+func withTimeout(op func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	return op(ctx)
+}
+
+const (
+	backgroundRetries      = 10
+	backgroundRetryBackoff = 100 * time.Millisecond
+	backgroundRetryMax     = 5 * time.Second
+)
+
+// Repete uma operação que devolve o work para o redis. Enquanto ela falhar o work continua
+// na lista de processamento desta instância, que o reaper não devolve para a fila, então
+// o pagamento não pode ser abandonado nem marcado como falho
+func (w *Worker) retryInBackground(work *Work, op func(ctx context.Context) error, onSuccess func()) {
+	backoff := backgroundRetryBackoff
+
+	for range backgroundRetries {
+		time.Sleep(backoff)
+		backoff = min(backoff*2, backgroundRetryMax)
+
+		if err := withTimeout(op); err == nil {
+			onSuccess()
+			return
+		}
 	}
+
+	log.Printf("Giving up on %v: kept in the processing list until the instance restarts\n", work.Payload.CorrelationID)
 }
 
-func (w *Worker) handleProcessingFailure(work *Work) {
-	w.workStore.remove(work.Payload.CorrelationID)
+func (w *Worker) deadLetter(work *Work, cause error) {
+	entry, err := newDeadLetter(work, cause)
+	if err != nil {
+		log.Printf("Failed to encode dead letter for %v: %v\n", work.Payload.CorrelationID, err)
+		return
+	}
+
+	pushed := func() {
+		// confirma o work somente após ele estar salvo na dead letter queue
+		if ackErr := withTimeout(func(ctx context.Context) error { return w.queue.Ack(ctx, work.Raw) }); ackErr != nil {
+			log.Printf("Failed to ack dead lettered work: %v\n", ackErr)
+		}
+
+		w.tracker.Failed(context.Background(), work.Payload.CorrelationID, cause)
+		metrics.DeadLetters.Inc()
+
+		log.Printf("Processing failed for %v after %d attempts: sent to dead letter queue", work.Payload.CorrelationID, work.Attempts)
+	}
+
+	push := func(ctx context.Context) error {
+		return w.deadLetters.push(ctx, entry)
+	}
+
+	if pushErr := withTimeout(push); pushErr != nil {
+		log.Printf("Failed to push %v to dead letter queue: %v\n", work.Payload.CorrelationID, pushErr)
+		w.async(func() { w.retryInBackground(work, push, pushed) })
+		return
+	}
 
+	pushed()
+}
+
+// Confirma o processamento do work na fila
+func (w *Worker) ack(work *Work) {
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
 	defer cancel()
 
-	if pushErr := w.redisClient.RPush(
-		ctx, w.workQueueKey, work.Raw,
-	).Err(); pushErr != nil {
-		log.Println("Failed to push back to queue on processing failure handler")
+	if err := w.queue.Ack(ctx, work.Raw); err != nil {
+		log.Printf("Failed to ack work: %v\n", err)
 	}
+}
+
+// Confirma o work e marca o pagamento como concluído para descartar duplicatas
+func (w *Worker) complete(work *Work) {
+	w.dedup.Complete(context.Background(), work.Payload.CorrelationID)
+	w.ack(work)
+}
+
+// Pagamento reservado por outro worker: volta para a fila sem contar como tentativa.
+// Se a reserva for de uma instância que parou ela expira e uma nova tentativa processa o pagamento
+func (w *Worker) postpone(work *Work) {
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
 
-	log.Printf("Processing failed for %v: sent back to work queue for retry", work.Payload.CorrelationID)
+	if err := w.queue.Requeue(ctx, work.Raw, work.Raw, w.inFlightDelay); err != nil {
+		log.Printf("Failed to postpone in flight payment %v: %v\n", work.Payload.CorrelationID, err)
+	}
 }
 
 func (w *Worker) publishResult(result *workResult) {
-	if err := w.resultsHandler.updateResults(
-		context.Background(), result.counterKey, result.amountKey, result.timestamp, result.amountValue,
+	if err := w.results.Record(
+		context.Background(), result.host, result.timestamp, result.amountValue,
 	); err != nil {
 		log.Printf("Failed to publish worker results: %v | result: %v\n", err, result)
+		metrics.ResultsPublishFailures.Inc()
 	}
+
+	w.tracker.Processed(context.Background(), result.correlationID, result.host)
 }
 
 func (w *Worker) Execute(work *Work) error {
 	// log.Printf("Executing worker %v", w.ID)
 	timestamp := time.Now().UTC()
+	// síncrono para não sobrescrever um status posterior (retrying, processed, failed)
+	w.tracker.InFlight(context.Background(), work.Payload.CorrelationID)
+
 	work.Payload.RequestedAt = timestamp.Format("2006-01-02T15:04:05.000Z")
 
 	data, err := json.Marshal(work.Payload)
@@ -128,12 +315,13 @@ func (w *Worker) Execute(work *Work) error {
 		return err
 	}
 
-	go w.publishResult(&workResult{
-		amountKey:   "amount:" + string(host) + ":counter",
-		counterKey:  string(host) + ":counter",
-		timestamp:   timestamp.UnixMilli(),
-		amountValue: work.Payload.Amount,
-	})
+	result := &workResult{
+		correlationID: work.Payload.CorrelationID,
+		host:          string(host),
+		timestamp:     timestamp.UnixMilli(),
+		amountValue:   work.Payload.Amount,
+	}
+	w.async(func() { w.publishResult(result) })
 
 	return nil
 }
@@ -147,29 +335,95 @@ func (w *Worker) Start() {
 			// bloqueia até chegar algum work
 			work := <-w.chWork
 
-			var workPayload WorkPayload
-			err := json.Unmarshal(work.Raw, &workPayload)
-			if err != nil {
-				log.Println("Error processing work: failed to parse payload")
-				continue
+			// work nil sinaliza que o worker foi removido da pool
+			if work == nil {
+				return
 			}
 
-			if seen := w.workStore.contains(workPayload.CorrelationID); seen {
-				log.Printf("Payment already processed: discarding %v", work.Payload.CorrelationID)
-				continue
-			}
+			w.process(work)
+		}
+	}()
+}
 
-			w.workStore.add(workPayload.CorrelationID)
-			work.Payload = &workPayload
+// Executa uma tarefa em background contabilizada como work em andamento,
+// para que o shutdown aguarde sua conclusão
+func (w *Worker) async(fn func()) {
+	w.inFlight.Add(1)
+	go func() {
+		defer w.inFlight.Done()
+		fn()
+	}()
+}
 
-			err = w.Execute(work)
-			if err != nil {
-				if errors.Is(err, http.ErrAlreadyProcessed) {
-					continue
-				}
+// Fora do modo strict o payload não é validado no ingress e o pagamento já foi aceito:
+// valores com mais de 2 casas decimais são arredondados em vez de descartados
+func decodePayload(payment []byte) (*WorkPayload, error) {
+	var workPayload WorkPayload
+	err := json.Unmarshal(payment, &workPayload)
+	if err == nil || !errors.Is(err, money.ErrTooManyDecimal) {
+		return &workPayload, err
+	}
 
-				go w.handleProcessingFailure(work)
-			}
-		}
-	}()
+	var lenient struct {
+		WorkPayload
+		Amount json.Number `json:"amount"`
+	}
+	if err := json.Unmarshal(payment, &lenient); err != nil {
+		return nil, err
+	}
+
+	amount, err := money.Round(lenient.Amount.String())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Amount %s of %v rounded to %v\n", lenient.Amount, lenient.CorrelationID, amount)
+
+	workPayload = lenient.WorkPayload
+	workPayload.Amount = amount
+	return &workPayload, nil
+}
+
+// O dispatcher contabiliza o work em andamento antes de entregá-lo ao worker
+func (w *Worker) process(work *Work) {
+	defer w.inFlight.Done()
+
+	envelope, err := decodeQueueEntry(work.Raw)
+	if err != nil {
+		log.Println("Error processing work: failed to parse queue entry")
+		w.async(func() { w.ack(work) })
+		return
+	}
+
+	work.Payment = envelope.Payment
+	work.Attempts = envelope.Attempts
+	work.Deferrals = envelope.Deferrals
+
+	workPayload, err := decodePayload(work.Payment)
+	if err != nil {
+		log.Println("Error processing work: failed to parse payload")
+		w.async(func() { w.ack(work) })
+		return
+	}
+
+	work.Payload = workPayload
+
+	switch w.dedup.Claim(context.Background(), workPayload.CorrelationID) {
+	case dedup.Done:
+		log.Printf("Payment already processed: discarding %v", workPayload.CorrelationID)
+		w.async(func() { w.ack(work) })
+		return
+	case dedup.InFlight:
+		log.Printf("Payment in flight on another worker: postponing %v", workPayload.CorrelationID)
+		w.async(func() { w.postpone(work) })
+		return
+	}
+
+	err = w.Execute(work)
+	if err != nil && !errors.Is(err, http.ErrAlreadyProcessed) {
+		w.async(func() { w.handleProcessingFailure(work, err) })
+		return
+	}
+
+	w.async(func() { w.complete(work) })
 }
@@ -12,7 +12,11 @@ import (
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/balancer"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/dispatcher"
 	httpClient "github.com/igorMSoares/rinha-de-backend-2025/internal/http"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/metrics"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/queue"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/results"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/server"
+	"github.com/igorMSoares/rinha-de-backend-2025/internal/tracker"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/utils"
 	"github.com/igorMSoares/rinha-de-backend-2025/internal/worker"
 	"github.com/joho/godotenv"
@@ -40,19 +44,49 @@ func main() {
 		log.Fatalf("Failed to connect to redis client: %v\n", err)
 	}
 
-	resultsHandler := worker.NewResultsHandler(redisClient)
+	// cancelado no shutdown para encerrar as rotinas em background
+	appCtx, cancelApp := context.WithCancel(context.Background())
 
-	server := server.NewServer("processed", redisClient, resultsHandler)
-	go server.Start()
+	var resultsStore results.Store
+	switch utils.Getenv("RESULTS_BACKEND", "redis") {
+	case "memory":
+		// somente para uma única instância: os resultados não são compartilhados
+		memoryStore := results.NewMemoryStore()
+		go memoryStore.ListenPurge(redisClient, worker.PurgeChannel)
+		resultsStore = memoryStore
+	default:
+		redisStore := results.NewRedisStore(redisClient)
+		go redisStore.StartCompaction(appCtx)
+		resultsStore = redisStore
+	}
+	paymentTracker := tracker.NewTracker(redisClient)
+
+	var workQueue queue.Queue
+	var redisQueue *queue.RedisQueue
+	switch utils.Getenv("QUEUE_BACKEND", "redis") {
+	case "memory":
+		// somente para uma única instância: a fila não é compartilhada
+		memoryQueue := queue.NewMemoryQueue()
+		go memoryQueue.ListenPurge(redisClient, worker.PurgeChannel)
+		workQueue = memoryQueue
+	default:
+		redisQueue = queue.NewRedisQueue(redisClient)
+		redisQueue.Start(appCtx)
+		workQueue = redisQueue
+	}
+
+	deadLetters := worker.NewDeadLetterQueue(redisClient, workQueue)
 
 	defaultCfg := &httpClient.HostCfg{
-		Addr:     "payment-processor-default:8080",
-		Endpoint: "http://payment-processor-default:8080/payments",
+		Addr:           "payment-processor-default:8080",
+		Endpoint:       "http://payment-processor-default:8080/payments",
+		HealthEndpoint: "http://payment-processor-default:8080/payments/service-health",
 	}
 
 	fallbackCfg := &httpClient.HostCfg{
-		Addr:     "payment-processor-fallback:8080",
-		Endpoint: "http://payment-processor-fallback:8080/payments",
+		Addr:           "payment-processor-fallback:8080",
+		Endpoint:       "http://payment-processor-fallback:8080/payments",
+		HealthEndpoint: "http://payment-processor-fallback:8080/payments/service-health",
 	}
 
 	costWeight, _ := strconv.ParseFloat(utils.Getenv("COST_WEIGHT", "0.5"), 64)
@@ -65,13 +99,54 @@ func main() {
 		costWeight,
 		latencyThreshold,
 	)
+	go loadBalancer.ListenConfig(redisClient)
 
-	workDispatcher := dispatcher.NewWorkDispatcher(loadBalancer, redisClient, resultsHandler)
+	go balancer.NewHealthPoller(loadBalancer, redisClient).Start(appCtx)
+	go balancer.NewStatsSync(loadBalancer, redisClient).Start(appCtx)
+
+	queue.RegisterMetrics(metrics.Default, workQueue)
+	loadBalancer.RegisterMetrics(metrics.Default)
+
+	server := server.NewServer("processed", redisClient, workQueue, resultsStore, paymentTracker, deadLetters, loadBalancer)
+
+	workDispatcher := dispatcher.NewWorkDispatcher(loadBalancer, redisClient, resultsStore, paymentTracker, deadLetters, workQueue)
 
 	workDispatcher.Start()
 
+	server.AddReadinessCheck("dispatcher", workDispatcher.Ready)
+	// a indisponibilidade dos processors afeta todas as instâncias: os pagamentos
+	// continuam sendo aceitos e ficam na fila
+	server.AddDegradedCheck("processors", loadBalancer.Ready)
+	go server.WatchReadiness(appCtx)
+	go server.Start()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 	log.Println("Received shutdown signal")
+
+	shutdownTimeout := utils.GetenvDuration("SHUTDOWN_TIMEOUT", "8s")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// para de aceitar pagamentos antes de parar de consumir a fila
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Failed to shutdown server gracefully: %v\n", err)
+	}
+
+	workDispatcher.Stop(ctx)
+	cancelApp()
+
+	if redisQueue != nil {
+		// o deadline pode já ter passado: devolver os works para a fila ainda é necessário
+		closeCtx, closeCancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer closeCancel()
+
+		if err := redisQueue.Close(closeCtx); err != nil {
+			log.Printf("Failed to return in flight works to work_queue: %v\n", err)
+		}
+	}
+
+	redisClient.Close()
+	log.Println("Shutdown complete")
 }